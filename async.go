@@ -0,0 +1,116 @@
+package postcodeapi
+
+import (
+	"context"
+	"sync"
+)
+
+// struct for a lookup running in the background
+type Future struct {
+	done     chan struct{}
+	response *ApiFullResponse
+	err      error
+}
+
+// function to wait for the lookup and get its result (same as GetPostcodeInfoContext)
+func (f *Future) Get() (*ApiFullResponse, error) {
+	<-f.done
+	return f.response, f.err
+}
+
+// channel that is closed when the lookup is done
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// function to start a lookup in the background, e.g. for prefetching
+// shares the cache and in-flight requests with the sync methods, cancelling ctx aborts the api request
+// returns ErrClosed after Shutdown
+func (api *ApiClientSettings) GetPostcodeInfoAsync(ctx context.Context, postcode string, number string) *Future {
+	f := &Future{done: make(chan struct{})}
+	started := api.goBackground(func() {
+		defer close(f.done)
+		f.response, f.err = api.GetPostcodeInfoContext(ctx, postcode, number)
+	})
+	if !started {
+		f.err = ErrClosed
+		close(f.done)
+	}
+	return f
+}
+
+// struct to deduplicate concurrent api requests for the same key
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// struct for a shared api request and the callers waiting for it
+type flightCall struct {
+	done     chan struct{}
+	response *ApiFullResponse
+	err      error
+	waiters  int
+	cancel   context.CancelFunc
+}
+
+// function to run fn once per key at a time, other callers for the same key wait for its result
+// fn runs on a context derived from base, not from a caller, so one caller giving up doesn't fail the others
+// every caller returns early with ctx.Err() when its own ctx is done, fn is cancelled when no caller is left
+func (g *flightGroup) do(ctx context.Context, base context.Context, key string, fn func(ctx context.Context) (*ApiFullResponse, error)) (*ApiFullResponse, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(base)
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go func() {
+			call.response, call.err = fn(callCtx)
+			cancel()
+			g.forget(key, call)
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.response, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		abandoned := call.waiters == 0
+		if abandoned && g.calls[key] == call {
+			// nobody waits for the result anymore, later callers start a new request
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		if abandoned {
+			call.cancel()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// function to remove a call, unless it was already replaced by a newer call for the key
+func (g *flightGroup) forget(key string, call *flightCall) {
+	g.mu.Lock()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+}
+
+// context with the deadline and cancellation of the client (BaseContext) and the values of a caller (e.g. trace spans)
+type flightContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c flightContext) Value(key any) any {
+	return c.values.Value(key)
+}
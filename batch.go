@@ -0,0 +1,195 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// struct for a postcode / number combination
+type PostcodeNumber struct {
+	Postcode string `json:"postcode"`
+	Number   string `json:"number"`
+}
+
+// function to check if cached entry is still fresh
+// errors (e.g. 404) are only served from cache for 1/6 of the ttl (see errorTtl)
+func (api *ApiClientSettings) isFresh(cached *cache) bool {
+	if cached == nil {
+		return false
+	}
+	if cached.ApiFullResponse.Outcome == OutcomeOK {
+		return time.Since(cached.CachedAt) < api.entryTtl(cached)
+	}
+	return time.Since(cached.CachedAt) < api.errorTtl(cached)
+}
+
+// function to check which postcode / number combinations are present and fresh in cache
+// no api calls are made, so this can be used to estimate the cost of a batch
+func (api *ApiClientSettings) CachedStatus(pairs []PostcodeNumber) map[PostcodeNumber]bool {
+	status := make(map[PostcodeNumber]bool, len(pairs))
+	for _, pair := range pairs {
+		cached, _ := api.getCached(pair.Postcode, pair.Number)
+		status[pair] = api.isFresh(cached)
+	}
+	return status
+}
+
+// struct for the result of a single lookup in a batch or stream
+type Result struct {
+	Input    PostcodeNumber   `json:"input"`
+	Response *ApiFullResponse `json:"response,omitempty"`
+	Err      error            `json:"-"`
+}
+
+// type for the per-item result of BatchGetPostcodeInfo, Err holds the error of a failed item
+type BatchResult = Result
+
+// function to resolve postcode / number combinations from a channel
+// results are sent in input order, the output channel is closed when in is drained, ctx is done or on Shutdown
+func (api *ApiClientSettings) ResolveStream(ctx context.Context, in <-chan PostcodeNumber) <-chan Result {
+	out := make(chan Result)
+	stopped := api.lifecycle.stopped()
+	started := api.goBackground(func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopped:
+				return
+			case pair, ok := <-in:
+				if !ok || ctx.Err() != nil {
+					return
+				}
+				apiResponse, err := api.GetPostcodeInfoContext(ctx, pair.Postcode, pair.Number)
+				select {
+				case out <- Result{Input: pair, Response: apiResponse, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	})
+	if !started {
+		close(out)
+	}
+	return out
+}
+
+// function to group responses by municipality, nil and error responses are skipped
+func GroupByMunicipality(responses []*ApiFullResponse) map[string][]*ApiFullResponse {
+	return groupBy(responses, func(r *ApiFullResponse) string { return r.Municipality })
+}
+
+// function to group responses by province, nil and error responses are skipped
+func GroupByProvince(responses []*ApiFullResponse) map[string][]*ApiFullResponse {
+	return groupBy(responses, func(r *ApiFullResponse) string { return r.Province })
+}
+
+// function to group valid responses by key
+func groupBy(responses []*ApiFullResponse, key func(*ApiFullResponse) string) map[string][]*ApiFullResponse {
+	groups := make(map[string][]*ApiFullResponse)
+	for _, r := range responses {
+		if r == nil || r.outcome() != OutcomeOK {
+			continue
+		}
+		groups[key(r)] = append(groups[key(r)], r)
+	}
+	return groups
+}
+
+// default number of concurrent lookups in a batch
+const defaultBatchConcurrency = 4
+
+// function to resolve postcode / number combinations with BatchConcurrency workers
+// results are returned in input order, api requests are throttled by RequestsPerMinute
+// after ctx is done no new lookups are started, their results have ctx.Err() as error
+func (api *ApiClientSettings) resolveAll(ctx context.Context, pairs []PostcodeNumber) []Result {
+	workers := api.BatchConcurrency
+	if workers <= 0 {
+		workers = defaultBatchConcurrency
+	}
+	results := make([]Result, len(pairs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	var progressMu sync.Mutex
+	done := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// don't start new lookups after cancellation
+				if ctx.Err() != nil {
+					results[i] = Result{Input: pairs[i], Err: ctx.Err()}
+					continue
+				}
+				apiResponse, err := api.resolveItem(ctx, pairs[i])
+				results[i] = Result{Input: pairs[i], Response: apiResponse, Err: err}
+				if api.ProgressFunc != nil {
+					// serialized, so the callback doesn't need to be thread-safe
+					progressMu.Lock()
+					done++
+					api.ProgressFunc(done, len(pairs))
+					progressMu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range pairs {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			// lookups that were not started
+			results[i] = Result{Input: pairs[i], Err: ctx.Err()}
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// function to resolve a batch of postcode / number combinations concurrently (see BatchConcurrency)
+// results are returned in input order with the error of each item, ProgressFunc is called as lookups complete
+// stops promptly when ctx is done and returns ctx.Err() with the results so far
+func (api *ApiClientSettings) BatchGetPostcodeInfo(ctx context.Context, pairs []PostcodeNumber) ([]BatchResult, error) {
+	results := api.resolveAll(ctx, pairs)
+	return results, ctx.Err()
+}
+
+// function to resolve a single batch item, limited to BatchItemTimeout
+func (api *ApiClientSettings) resolveItem(ctx context.Context, pair PostcodeNumber) (*ApiFullResponse, error) {
+	if api.BatchItemTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.BatchItemTimeout)
+		defer cancel()
+	}
+	return api.GetPostcodeInfoContext(ctx, pair.Postcode, pair.Number)
+}
+
+// function to resolve several house numbers of one postcode concurrently, e.g. all units of a building
+// each number is cached individually (use PostcodeLevelCache to share street / city between numbers)
+// not found numbers are included in the map, other failures are left out and returned as a joined error
+func (api *ApiClientSettings) GetPostcodeInfoNumbers(ctx context.Context, postcode string, numbers []string) (map[string]*ApiFullResponse, error) {
+	pairs := make([]PostcodeNumber, len(numbers))
+	for i, number := range numbers {
+		pairs[i] = PostcodeNumber{Postcode: postcode, Number: number}
+	}
+
+	responses := make(map[string]*ApiFullResponse, len(numbers))
+	var errs []error
+	for _, result := range api.resolveAll(ctx, pairs) {
+		if result.Response != nil && (result.Err == nil || errors.Is(result.Err, ErrNotFound)) {
+			responses[result.Input.Number] = result.Response
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s %s: %w", postcode, result.Input.Number, result.Err))
+	}
+	if ctx.Err() != nil {
+		return responses, ctx.Err()
+	}
+	return responses, errors.Join(errs...)
+}
@@ -0,0 +1,50 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBatchCancelMidway(t *testing.T) {
+	const pairCount, cancelAfter, workers = 50, 4, 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var served atomic.Int32
+	api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		if served.Add(1) == cancelAfter {
+			cancel()
+		}
+		w.Write([]byte(testAddressJson))
+	})
+	api.BatchConcurrency = workers
+
+	pairs := make([]PostcodeNumber, pairCount)
+	for i := range pairs {
+		pairs[i] = PostcodeNumber{Postcode: "6931XE", Number: strconv.Itoa(i + 1)}
+	}
+	results, err := api.BatchGetPostcodeInfo(ctx, pairs)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+
+	// workers stop after the lookups they were running when the batch was cancelled
+	if n := hits.Load(); n < cancelAfter || n > cancelAfter+workers {
+		t.Errorf("%d api requests, want %d up to %d", n, cancelAfter, cancelAfter+workers)
+	}
+	cancelled := 0
+	for i, result := range results {
+		if result.Input != pairs[i] {
+			t.Errorf("result %d is for %v, want %v", i, result.Input, pairs[i])
+		}
+		if errors.Is(result.Err, context.Canceled) {
+			cancelled++
+		}
+	}
+	if cancelled < pairCount-cancelAfter-workers {
+		t.Errorf("%d cancelled results, want at least %d", cancelled, pairCount-cancelAfter-workers)
+	}
+}
@@ -2,7 +2,12 @@ package postcodeapi
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/tidwall/buntdb"
@@ -11,85 +16,388 @@ import (
 // struct for cache
 type cache struct {
 	ApiFullResponse
-	CachedAt time.Time `json:"cached_at"`
+	CachedAt         time.Time       `json:"cached_at"`                    // same as LastRefreshedAt
+	OriginalCachedAt time.Time       `json:"original_cached_at,omitempty"` // first time the key was cached
+	LastRefreshedAt  time.Time       `json:"last_refreshed_at,omitempty"`  // last time the key was cached
+	Misses           int             `json:"misses,omitempty"`             // consecutive not found lookups, for NegativeTtlBackoff
+	Raw              json.RawMessage `json:"raw,omitempty"`                // api response body, for StoreRawResponse
+	NoGeo            bool            `json:"no_geo,omitempty"`             // api response had no geo, so GetCoordinates doesn't re-fetch
+	Version          int             `json:"version,omitempty"`            // schema version of the entry (see cacheVersion)
+	Ttl              time.Duration   `json:"ttl,omitempty"`                // ttl chosen by CacheDecision, 0 = CacheTtl
+}
+
+// schema version of cache entries, increase when the meaning of stored fields changes
+// entries without version are from before versioning and are upgraded on read, newer versions are ignored
+const cacheVersion = 1
+
+// function to upgrade a cache entry from an older schema version, returns false for unknown (newer) versions
+func (c *cache) migrate() bool {
+	if c.Version > cacheVersion {
+		return false
+	}
+	// fill outcome for entries cached before Outcome existed, so not found entries are detected by Outcome only
+	if c.Outcome == "" {
+		c.Outcome = c.outcome()
+	}
+	c.Version = cacheVersion
+	return true
 }
 
 type cacheDb struct {
 	bunt *buntdb.DB
+	lazy *lazyDb            // set when the db is opened on first use
+	api  *ApiClientSettings // client of the db, for its Serializer
+}
+
+// struct for a db that is opened on first use
+type lazyDb struct {
+	once sync.Once
+	open func() (*buntdb.DB, error)
+	bunt *buntdb.DB
+	err  error
 }
 
 // init cache db
 func (api *ApiClientSettings) InitDb() cacheDb {
+	// open db file
+	db, err := api.openDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cacheDb{bunt: db, api: api}
+}
+
+// function to open the db file
+func (api *ApiClientSettings) openDb() (*buntdb.DB, error) {
 	// check if db file is specified
 	// if not, use default file name
+	api.CacheFile = api.CachePath()
+	// lock the file against other processes, optionally running degraded with an in-memory cache
+	// read-only clients don't write, so they don't lock and can run next to the process that does
+	if !api.ReadOnlyCache {
+		if err := api.lockCacheFile(api.CacheFile); err != nil {
+			if !errors.Is(err, ErrCacheLocked) || !api.InMemoryFallback {
+				return nil, err
+			}
+			log.Println(err, "(using an in-memory cache)")
+			api.CacheFile = ":memory:"
+		}
+	}
+	db, err := buntdb.Open(api.CacheFile)
+	if err != nil {
+		api.unlockCacheFile()
+		return nil, err
+	}
+	// apply the sync policy
+	if err := api.SyncPolicy.apply(db); err != nil {
+		db.Close()
+		api.unlockCacheFile()
+		return nil, err
+	}
+	// namespace keys of caches from before namespacing, read-only caches are read with the old keys as fallback
+	if api.ReadOnlyCache {
+		api.legacyKeys = hasLegacyKeys(db)
+	} else if err := migrateKeys(db); err != nil {
+		db.Close()
+		api.unlockCacheFile()
+		return nil, err
+	}
+	return db, nil
+}
+
+// function to get the path of the cache file in use (":memory:" for an in-memory cache), e.g. for backups
+// for lazy clients this is the file that will be opened on first use
+func (api *ApiClientSettings) CachePath() string {
 	if api.CacheFile == "" {
-		api.CacheFile = "./data/pcapi_cache.db"
+		return DefaultCacheFile
 	}
+	return api.CacheFile
+}
 
-	// open db file
-	db, err := buntdb.Open(api.CacheFile)
+// type for how often the cache file is fsynced, a trade off between durability and write throughput
+type SyncPolicy int
+
+const (
+	SyncDefault     SyncPolicy = iota // buntdb's default (EverySecond)
+	SyncNever                         // leave syncing to the os, fastest but writes may be lost on a crash
+	SyncEverySecond                   // at most one second of writes lost on a crash, e.g. for cache warmers
+	SyncAlways                        // sync after every write, safest but slowest
+)
+
+// function to set the sync policy on the db
+func (p SyncPolicy) apply(db *buntdb.DB) error {
+	var policy buntdb.SyncPolicy
+	switch p {
+	case SyncDefault:
+		return nil
+	case SyncNever:
+		policy = buntdb.Never
+	case SyncEverySecond:
+		policy = buntdb.EverySecond
+	case SyncAlways:
+		policy = buntdb.Always
+	default:
+		return fmt.Errorf("%w: unknown sync policy %d", ErrInvalidInput, p)
+	}
+	var config buntdb.Config
+	if err := db.ReadConfig(&config); err != nil {
+		return err
+	}
+	config.SyncPolicy = policy
+	return db.SetConfig(config)
+}
+
+// function to get the db, opening it on first use for lazy cache dbs
+func (c *cacheDb) db() (*buntdb.DB, error) {
+	if c.lazy == nil {
+		return c.bunt, nil
+	}
+	c.lazy.once.Do(func() {
+		c.lazy.bunt, c.lazy.err = c.lazy.open()
+	})
+	return c.lazy.bunt, c.lazy.err
+}
+
+// function to close the db, a lazy db that is not opened yet won't be opened anymore
+func (c *cacheDb) close() error {
+	if c.lazy != nil {
+		c.lazy.once.Do(func() {
+			c.lazy.err = ErrClosed
+		})
+		if c.lazy.bunt == nil {
+			return nil
+		}
+		return c.lazy.bunt.Close()
+	}
+	if c.bunt == nil {
+		return nil
+	}
+	return c.bunt.Close()
+}
+
+// function to run a read-only transaction
+func (c *cacheDb) view(fn func(tx *buntdb.Tx) error) error {
+	db, err := c.db()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	return cacheDb{bunt: db}
+	return db.View(fn)
 }
 
-// function to save to cache
-func (c *cacheDb) SaveToCache(key string, value cache) {
-	// type cache to json
-	valueJson, err := json.Marshal(value)
+// function to run a read-write transaction
+func (c *cacheDb) update(fn func(tx *buntdb.Tx) error) error {
+	db, err := c.db()
 	if err != nil {
-		log.Println(err)
-		return
+		return err
 	}
-	c.bunt.Update(func(tx *buntdb.Tx) error {
-		// save to cache
-		tx.Set(key, string(valueJson), nil)
-		return nil
+	return db.Update(fn)
+}
+
+// interface for a key/value store used to cache address entries (e.g. buntdb or redis)
+type Cache interface {
+	Get(key string) (value string, ok bool)
+	Set(key string, value string)
+	Delete(key string)
+}
+
+// function to get a value from the buntdb cache
+func (c *cacheDb) Get(key string) (string, bool) {
+	var value string
+	err := c.view(func(tx *buntdb.Tx) error {
+		var err error
+		value, err = tx.Get(key)
+		return err
+	})
+	return value, err == nil
+}
+
+// function to set a value in the buntdb cache
+func (c *cacheDb) Set(key string, value string) {
+	c.update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(key, value, nil)
+		return err
+	})
+}
+
+// function to delete from cache
+func (c *cacheDb) Delete(key string) {
+	c.update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(key)
+		return err
 	})
 }
 
+// function to save to cache
+func (c *cacheDb) SaveToCache(key string, value cache) {
+	saveEntry(c, c.serializer(), key, value)
+}
+
 // function to get from cache (returns cache struct) or nil
-// get from cache by key (postcode+number)
+// get from cache by key (see addressKey)
 func (c *cacheDb) GetFromCache(key string) *cache {
-	var value cache
-	c.bunt.View(func(tx *buntdb.Tx) error {
-		val, err := tx.Get(key)
-		if err != nil {
-			return err
+	value, _ := getEntry(c, c.serializer(), key)
+	return value
+}
+
+// function to get the serializer of the client of the db, json when the db has no client
+func (c *cacheDb) serializer() Serializer {
+	if c.api == nil {
+		return JSONSerializer{}
+	}
+	return c.api.serializer()
+}
+
+// function to save a cache entry encoded with ser
+// the OriginalCachedAt of an existing entry for the key is kept, CachedAt and LastRefreshedAt are set to value.CachedAt
+func saveEntry(c Cache, ser Serializer, key string, value cache) {
+	value.Version = cacheVersion
+	value.LastRefreshedAt = value.CachedAt
+	value.OriginalCachedAt = value.CachedAt
+	if existing, _ := getEntry(c, ser, key); existing != nil {
+		if !existing.OriginalCachedAt.IsZero() {
+			value.OriginalCachedAt = existing.OriginalCachedAt
+		} else if !existing.CachedAt.IsZero() {
+			value.OriginalCachedAt = existing.CachedAt
 		}
-		// convert json to struct
-		err = json.Unmarshal([]byte(val), &value)
-		if err != nil {
-			return err
+	}
+
+	// type cache to json (or the format of ser)
+	encoded, err := ser.Marshal(value)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	c.Set(key, string(encoded))
+}
+
+// function to save an address cache entry, keeping the unknown fields of the existing entry with PreserveUnknownFields
+func (api *ApiClientSettings) storeEntry(key string, value cache) {
+	if !api.PreserveUnknownFields {
+		value.Extra = nil
+	} else if existing, _ := getEntry(api.addressCache(), api.serializer(), key); existing != nil {
+		for field, raw := range existing.Extra {
+			if _, ok := value.Extra[field]; ok {
+				continue
+			}
+			if value.Extra == nil {
+				value.Extra = make(map[string]json.RawMessage)
+			}
+			value.Extra[field] = raw
 		}
-		return nil
-	})
-	return &value
+	}
+	saveEntry(api.addressCache(), api.serializer(), key, value)
+	api.hotCache.remove(key)
+}
+
+// function to get a cache entry, returns nil if the key is not cached
+// and nil with ErrCacheCorrupt if the cached value can't be decoded
+func getEntry(c Cache, ser Serializer, key string) (*cache, error) {
+	val, ok := c.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	// convert json to struct
+	var value cache
+	if err := ser.Unmarshal([]byte(val), &value); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCacheCorrupt, key, err)
+	}
+	// entries written by a newer version of this package are treated as not cached
+	if !value.migrate() {
+		return nil, nil
+	}
+	value.FetchedAt = value.CachedAt
+	return &value, nil
+}
+
+// function to get the cache used for address entries
+func (api *ApiClientSettings) addressCache() Cache {
+	if api.AddressCache != nil {
+		return api.AddressCache
+	}
+	return &api.Cache
 }
 
 // function to save api limits info to cache
+// no-op with DisableRateLimitPersistence
 func (api *ApiClientSettings) SaveToCache() {
-	// convert to json
-	json, err := json.Marshal(api.ApiInfo)
+	if api.ReadOnlyCache || api.DisableRateLimitPersistence {
+		return
+	}
+	// convert to json (or the format of the Serializer)
+	encoded, err := api.serializer().Marshal(api.ApiLimits())
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	// save to buntdb
-	api.Cache.bunt.Update(func(tx *buntdb.Tx) error {
-		tx.Set("api_info", string(json), nil)
+	now := time.Now()
+	api.Cache.update(func(tx *buntdb.Tx) error {
+		tx.Set(apiInfoKey, string(encoded), nil)
 		// set caching time
-		tx.Set("api_info_cached_at", time.Now().Format(time.RFC3339), nil)
+		tx.Set(apiInfoCachedAtKey, now.Format(time.RFC3339), nil)
+		// keep snapshot for rate limit history
+		if api.KeepRateLimitHistory {
+			key := fmt.Sprintf("%s%019d", rateLimitHistoryPrefix, now.UnixNano())
+			tx.Set(key, string(encoded), &buntdb.SetOptions{Expires: true, TTL: rateLimitHistoryTtl})
+		}
 		return nil
 	})
 }
 
+// key prefix and ttl for rate limit history snapshots
+const (
+	rateLimitHistoryPrefix = metaKeyPrefix + "api_info_history:"
+	rateLimitHistoryTtl    = 7 * 24 * time.Hour
+)
+
+// function to get rate limit snapshots since the given time (oldest first)
+// snapshots are only kept when KeepRateLimitHistory is enabled, for up to 7 days
+func (api *ApiClientSettings) RateLimitHistory(since time.Time) ([]ApiLimitInfoJson, error) {
+	var history []ApiLimitInfoJson
+	pivot := rateLimitHistoryPrefix
+	if !since.IsZero() {
+		pivot = fmt.Sprintf("%s%019d", rateLimitHistoryPrefix, since.UnixNano())
+	}
+	err := api.Cache.view(func(tx *buntdb.Tx) error {
+		var err error
+		tx.AscendGreaterOrEqual("", pivot, func(key, val string) bool {
+			if !strings.HasPrefix(key, rateLimitHistoryPrefix) {
+				return false
+			}
+			var nanos int64
+			nanos, err = strconv.ParseInt(strings.TrimPrefix(key, rateLimitHistoryPrefix), 10, 64)
+			if err != nil {
+				return false
+			}
+			var info ApiLimitsInfo
+			if err = api.serializer().Unmarshal([]byte(val), &info); err != nil {
+				return false
+			}
+			history = append(history, ApiLimitInfoJson{
+				MaxRequestsPerMinute:   info.MaxRequestsPerMinute,
+				RemainingRequests:      info.RemainingRequests,
+				MaxRequestsPerDay:      info.MaxRequestsPerDay,
+				RemainingRequestsToday: info.RemainingRequestsToday,
+				CachingTime:            time.Unix(0, nanos),
+			})
+			return true
+		})
+		return err
+	})
+	return history, err
+}
+
 // get api limits info caching time
+// with DisableRateLimitPersistence this is the time of the last api response of this client
 func (api *ApiClientSettings) GetCachingTime() time.Time {
+	if api.DisableRateLimitPersistence {
+		api.apiInfoMu.RLock()
+		defer api.apiInfoMu.RUnlock()
+		return api.apiInfoAt
+	}
 	var cachingTime time.Time
-	api.Cache.bunt.View(func(tx *buntdb.Tx) error {
-		val, err := tx.Get("api_info_cached_at")
+	api.Cache.view(func(tx *buntdb.Tx) error {
+		val, err := api.getMeta(tx, apiInfoCachedAtKey)
 		if err != nil {
 			return err
 		}
@@ -103,17 +411,298 @@ func (api *ApiClientSettings) GetCachingTime() time.Time {
 }
 
 // function to get api limits info from cache
+// no-op with DisableRateLimitPersistence
 func (api *ApiClientSettings) GetFromCache() {
-	api.Cache.bunt.View(func(tx *buntdb.Tx) error {
-		val, err := tx.Get("api_info")
-		if err != nil {
-			return err
+	if api.DisableRateLimitPersistence {
+		return
+	}
+	api.Cache.view(api.readApiInfo)
+}
+
+// function to read api limits info in a transaction
+func (api *ApiClientSettings) readApiInfo(tx *buntdb.Tx) error {
+	if api.DisableRateLimitPersistence {
+		return nil
+	}
+	val, err := api.getMeta(tx, apiInfoKey)
+	if err != nil {
+		return err
+	}
+	// convert json to struct
+	var info ApiLimitsInfo
+	err = api.serializer().Unmarshal([]byte(val), &info)
+	if err != nil {
+		return err
+	}
+	// keep the time the info was cached, so stale limits are not taken as current
+	// info without a (valid) caching time is taken as stale
+	var at time.Time
+	if val, err := api.getMeta(tx, apiInfoCachedAtKey); err == nil {
+		at, _ = time.Parse(time.RFC3339, val)
+	}
+	api.setApiLimits(info, at)
+	return nil
+}
+
+// function to get a meta key, falling back to the key from before namespacing for read-only caches (see migrateKeys)
+func (api *ApiClientSettings) getMeta(tx *buntdb.Tx, key string) (string, error) {
+	val, err := tx.Get(key)
+	if err == buntdb.ErrNotFound && api.legacyKeys {
+		val, err = tx.Get(strings.TrimPrefix(key, metaKeyPrefix))
+	}
+	return val, err
+}
+
+// function to get a copy of the last known api limits info, safe to call while lookups are running
+func (api *ApiClientSettings) ApiLimits() ApiLimitsInfo {
+	api.apiInfoMu.RLock()
+	defer api.apiInfoMu.RUnlock()
+	return api.ApiInfo
+}
+
+// function to get a copy of the last known api limits info and the time it was received
+func (api *ApiClientSettings) limitsAt() (ApiLimitsInfo, time.Time) {
+	api.apiInfoMu.RLock()
+	defer api.apiInfoMu.RUnlock()
+	return api.ApiInfo, api.apiInfoAt
+}
+
+// function to update the api limits info, received from the api at the given time
+func (api *ApiClientSettings) setApiLimits(info ApiLimitsInfo, at time.Time) {
+	api.apiInfoMu.Lock()
+	api.ApiInfo = info
+	api.apiInfoAt = at
+	api.recordBudget(info, at)
+	api.apiInfoMu.Unlock()
+}
+
+// function to get postcode / number from cache, using the postcode level cache if enabled
+// corrupt entries are returned as nil, with ErrCacheCorrupt in StrictCache mode
+func (api *ApiClientSettings) getCached(postcode string, number string) (*cache, error) {
+	cached, err := api.getCachedKey(api.addressKey(postcode, number))
+	if err != nil || !api.PostcodeLevelCache {
+		return cached, err
+	}
+	// errors (e.g. 404) are stored per number as is
+	if cached != nil && cached.Outcome != OutcomeOK {
+		return cached, nil
+	}
+	// get shared postcode level entry
+	shared, err := api.getCachedKey(api.postcodeKey(postcode))
+	if err != nil || shared == nil {
+		return cached, err
+	}
+	// number not cached yet, serve from postcode level entry
+	if cached == nil {
+		shared.Number, _ = strconv.Atoi(number)
+		return shared, nil
+	}
+	// merge number specific bits into postcode level entry
+	shared.Number = cached.Number
+	shared.Addition = cached.Addition
+	shared.Alternatives = cached.Alternatives
+	shared.Geo = cached.Geo
+	shared.NoGeo = cached.NoGeo
+	shared.CachedAt = cached.CachedAt
+	shared.FetchedAt = cached.FetchedAt
+	shared.Ttl = cached.Ttl
+	shared.Raw = cached.Raw
+	return shared, nil
+}
+
+// function to get a key from cache, handling corrupt entries according to the cache options
+func (api *ApiClientSettings) getCachedKey(key string) (*cache, error) {
+	if api.HotCacheSize > 0 {
+		if cached, ok := api.hotCache.get(key); ok {
+			return cached, nil
 		}
-		// convert json to struct
-		err = json.Unmarshal([]byte(val), &api.ApiInfo)
-		if err != nil {
-			return err
+	}
+	cached, err := getEntry(api.addressCache(), api.serializer(), key)
+	if err == nil && cached == nil && api.legacyKeys && api.Namespace == "" {
+		cached, err = getEntry(api.addressCache(), api.serializer(), strings.TrimPrefix(key, addressKeyPrefix))
+	}
+	if err == nil {
+		if cached != nil && api.HotCacheSize > 0 {
+			api.hotCache.put(key, *cached, api.HotCacheSize)
 		}
-		return nil
-	})
+		return cached, nil
+	}
+	log.Println(err)
+	if api.DeleteCorruptCache && !api.ReadOnlyCache {
+		api.addressCache().Delete(key)
+	}
+	if api.StrictCache {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// function to save postcode / number to cache, using the postcode level cache if enabled
+func (api *ApiClientSettings) saveCached(postcode string, number string, apiResponse *ApiFullResponse) {
+	if api.ReadOnlyCache {
+		return
+	}
+	// let CacheDecision skip the response or pick its ttl
+	var ttl time.Duration
+	if api.CacheDecision != nil {
+		store, decided := api.CacheDecision(apiResponse)
+		if !store {
+			return
+		}
+		ttl = decided
+	}
+
+	// only keep the fields to store, the raw body is kept as received
+	raw := apiResponse.raw
+	noGeo := apiResponse.outcome() == OutcomeOK && apiResponse.Geo.IsZero()
+	fields := api.StoreFields
+	if fields != 0 && api.keepGeo.Load() {
+		fields |= FieldGeo
+	}
+	apiResponse = fields.trim(apiResponse)
+
+	// api limits info is filled from the live limits on cache hits (see fillApiInfo)
+	if apiResponse.ApiInfo != (ApiLimitInfoJson{}) {
+		stored := *apiResponse
+		stored.ApiInfo = ApiLimitInfoJson{}
+		apiResponse = &stored
+	}
+
+	if !api.PostcodeLevelCache || apiResponse.outcome() != OutcomeOK {
+		entry := cache{ApiFullResponse: *apiResponse, CachedAt: time.Now(), NoGeo: noGeo, Ttl: ttl}
+		if api.NegativeTtlBackoff && apiResponse.Outcome == OutcomeNotFound {
+			entry.Misses = api.countMisses(api.addressKey(postcode, number))
+		}
+		if api.StoreRawResponse {
+			entry.Raw = raw
+		}
+		api.storeEntry(api.addressKey(postcode, number), entry)
+		return
+	}
+	// postcode level entry (street, city, municipality, province and geo of this number)
+	shared := *apiResponse
+	shared.Number = 0
+	shared.Addition = ""
+	shared.Alternatives = nil
+	shared.raw = nil
+	api.storeEntry(api.postcodeKey(postcode), cache{ApiFullResponse: shared, CachedAt: time.Now(), Ttl: ttl})
+
+	// number specific bits, including all matches of the number
+	own := ApiFullResponse{Postcode: apiResponse.Postcode, Number: apiResponse.Number, Addition: apiResponse.Addition, Outcome: apiResponse.Outcome}
+	own.Geo = apiResponse.Geo
+	own.Alternatives = apiResponse.Alternatives
+	entry := cache{ApiFullResponse: own, CachedAt: time.Now(), NoGeo: noGeo, Ttl: ttl}
+	if api.StoreRawResponse {
+		entry.Raw = raw
+	}
+	api.storeEntry(api.addressKey(postcode, number), entry)
+}
+
+// function to set the last known api limits info on a response served from cache
+// skipped when StoreFields leaves out FieldApiInfo or no api limits info is known yet
+func (api *ApiClientSettings) fillApiInfo(apiResponse *ApiFullResponse) {
+	if api.StoreFields != 0 && api.StoreFields&FieldApiInfo == 0 {
+		return
+	}
+	// in-memory, so cache hits don't need a db read
+	if info, at := api.limitsAt(); !at.IsZero() {
+		apiResponse.ApiInfo = info.withTime(at)
+	}
+}
+
+// type for a set of response fields to store in the cache
+type Fields uint
+
+const (
+	FieldStreet Fields = 1 << iota
+	FieldCity
+	FieldMunicipality
+	FieldProvince
+	FieldGeo
+	FieldApiInfo
+
+	// all fields (same as 0)
+	FieldAll = FieldStreet | FieldCity | FieldMunicipality | FieldProvince | FieldGeo | FieldApiInfo
+)
+
+// function to get a copy of the response with only the selected fields
+// postcode, number, addition, error, outcome, extra fields and the raw body are always kept, 0 keeps everything
+func (f Fields) trim(apiResponse *ApiFullResponse) *ApiFullResponse {
+	if f == 0 || f == FieldAll {
+		return apiResponse
+	}
+	trimmed := ApiFullResponse{
+		Postcode: apiResponse.Postcode,
+		Number:   apiResponse.Number,
+		Addition: apiResponse.Addition,
+		Error:    apiResponse.Error,
+		Outcome:  apiResponse.Outcome,
+		raw:      apiResponse.raw,
+	}
+	if f&FieldStreet != 0 {
+		trimmed.Street = apiResponse.Street
+	}
+	if f&FieldCity != 0 {
+		trimmed.City = apiResponse.City
+	}
+	if f&FieldMunicipality != 0 {
+		trimmed.Municipality = apiResponse.Municipality
+	}
+	if f&FieldProvince != 0 {
+		trimmed.Province = apiResponse.Province
+	}
+	if f&FieldGeo != 0 {
+		trimmed.Geo = apiResponse.Geo
+	}
+	if f&FieldApiInfo != 0 {
+		trimmed.ApiInfo = apiResponse.ApiInfo
+	}
+	trimmed.Extra = apiResponse.Extra
+	for i := range apiResponse.Alternatives {
+		trimmed.Alternatives = append(trimmed.Alternatives, *f.trim(&apiResponse.Alternatives[i]))
+	}
+	return &trimmed
+}
+
+// function to count consecutive not found lookups, including the current one
+func (api *ApiClientSettings) countMisses(key string) int {
+	previous, _ := getEntry(api.addressCache(), api.serializer(), key)
+	if previous == nil || previous.outcome() != OutcomeNotFound {
+		return 1
+	}
+	if previous.Misses < 1 {
+		return 2
+	}
+	return previous.Misses + 1
+}
+
+// function to get how long a found entry is served from cache, the ttl chosen by CacheDecision or CacheTtl
+// a CacheDecision ttl is capped at MaxCacheTtl like CacheTtl
+func (api *ApiClientSettings) entryTtl(cached *cache) time.Duration {
+	if cached.Ttl <= 0 {
+		return api.cacheTtl()
+	}
+	if api.MaxCacheTtl > 0 && cached.Ttl > api.MaxCacheTtl {
+		return api.MaxCacheTtl
+	}
+	return cached.Ttl
+}
+
+// function to get how long an error (e.g. 404) is served from cache, the ttl chosen by CacheDecision if any
+// otherwise 1/6 of the ttl, doubled for every repeated not found lookup with NegativeTtlBackoff (capped at the ttl)
+func (api *ApiClientSettings) errorTtl(cached *cache) time.Duration {
+	if cached.Ttl > 0 {
+		return api.entryTtl(cached)
+	}
+	maxTtl := api.cacheTtl()
+	ttl := maxTtl / 6
+	if api.NegativeTtlBackoff && cached.outcome() == OutcomeNotFound {
+		for i := 1; i < cached.Misses && ttl < maxTtl; i++ {
+			ttl *= 2
+		}
+		if ttl > maxTtl {
+			ttl = maxTtl
+		}
+	}
+	return ttl
 }
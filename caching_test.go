@@ -0,0 +1,67 @@
+package postcodeapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestGetFromCacheMiss(t *testing.T) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	c := cacheDb{bunt: db}
+	c.SaveToCache("6931XE130", cache{ApiFullResponse: ApiFullResponse{Street: "Dorpsstraat"}, CachedAt: time.Now()})
+	db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set("6931XE131", "not json", nil)
+		return err
+	})
+
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{"cached", "6931XE130", true},
+		{"missing", "6931XE132", false},
+		{"corrupt", "6931XE131", false},
+		{"empty key", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.GetFromCache(tt.key)
+			if (got != nil) != tt.want {
+				t.Fatalf("GetFromCache(%q) = %+v, want found %v", tt.key, got, tt.want)
+			}
+			if got != nil && got.Street != "Dorpsstraat" {
+				t.Errorf("GetFromCache(%q).Street = %q", tt.key, got.Street)
+			}
+		})
+	}
+}
+
+func TestReadOnlyCacheNextToWriter(t *testing.T) {
+	writer, _ := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAddressJson))
+	})
+	if _, err := writer.GetPostcodeInfoContext(context.Background(), "6931XE", "130"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writer holds the lock on the cache file
+	reader := NewApiClientSettingsLazy("token", writer.CachePath(), time.Hour)
+	reader.ReadOnlyCache = true
+	defer reader.Close()
+	info, err := reader.GetPostcodeInfoContext(context.Background(), "6931XE", "130")
+	if err != nil {
+		t.Fatalf("read-only lookup error = %v", err)
+	}
+	if info.Street != "Dorpsstraat" {
+		t.Errorf("street = %q, want Dorpsstraat", info.Street)
+	}
+}
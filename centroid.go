@@ -0,0 +1,103 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// default ttl of cached street centroids
+const defaultCentroidTtl = 24 * time.Hour
+
+// numbers fetched by StreetCentroid when no number of the postcode is cached, stops after centroidProbeSamples coordinates
+const (
+	centroidProbeNumbers = 6
+	centroidProbeSamples = 3
+)
+
+// function to get the ttl of cached street centroids
+func (api *ApiClientSettings) centroidTtl() time.Duration {
+	if api.CentroidTtl <= 0 {
+		return defaultCentroidTtl
+	}
+	return api.CentroidTtl
+}
+
+// function to approximate the center of the street of a postcode, e.g. to place one map pin per postcode
+// averages the coordinates of the cached numbers of the postcode, when none are cached numbers 1 to 6 are fetched
+// the centroid is cached for CentroidTtl, so new numbers are only included after it expires
+// returns ErrNoGeo when no coordinates are known for the postcode
+func (api *ApiClientSettings) StreetCentroid(ctx context.Context, postcode string) (lat, lon float64, err error) {
+	if err := ValidatePostcode(postcode); err != nil {
+		return 0, 0, err
+	}
+	key := api.centroidKey(postcode)
+
+	// cached centroid
+	if val, ok := api.Cache.Get(key); ok {
+		var centroid Geo
+		if api.serializer().Unmarshal([]byte(val), &centroid) == nil && !centroid.IsZero() {
+			return centroid.Lat, centroid.Lon, nil
+		}
+	}
+
+	// cached numbers of the postcode
+	var sum Geo
+	count := 0
+	prefix := api.addressKey(postcode, "")
+	err = api.Cache.view(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", prefix, func(key, val string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			var value cache
+			if api.serializer().Unmarshal([]byte(val), &value) != nil || !value.migrate() || value.outcome() != OutcomeOK || value.Geo.IsZero() {
+				return true
+			}
+			sum.Lat += value.Geo.Lat
+			sum.Lon += value.Geo.Lon
+			count++
+			return true
+		})
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// fetch a few numbers when none are cached
+	if count == 0 {
+		for number := 1; number <= centroidProbeNumbers; number++ {
+			geo, err := api.GetCoordinates(ctx, postcode, strconv.Itoa(number))
+			if errors.Is(err, ErrNotFound) || errors.Is(err, ErrNoGeo) {
+				continue
+			}
+			if err != nil {
+				return 0, 0, err
+			}
+			sum.Lat += geo.Lat
+			sum.Lon += geo.Lon
+			if count++; count >= centroidProbeSamples {
+				break
+			}
+		}
+	}
+	if count == 0 {
+		return 0, 0, ErrNoGeo
+	}
+	centroid := Geo{Lat: sum.Lat / float64(count), Lon: sum.Lon / float64(count)}
+
+	// save centroid
+	if !api.ReadOnlyCache {
+		if encoded, err := api.serializer().Marshal(centroid); err == nil {
+			api.Cache.update(func(tx *buntdb.Tx) error {
+				_, _, err := tx.Set(key, string(encoded), &buntdb.SetOptions{Expires: true, TTL: api.centroidTtl()})
+				return err
+			})
+		}
+	}
+	return centroid.Lat, centroid.Lon, nil
+}
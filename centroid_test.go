@@ -0,0 +1,32 @@
+package postcodeapi
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestStreetCentroidProbes(t *testing.T) {
+	// number 1 doesn't exist, the others are at lat 51 + number / 100
+	api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		number := r.URL.Query().Get("number")
+		if number == "1" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"postcode":"6931XE","number":%s,"street":"Dorpsstraat","geo":{"lat":51.0%s,"lon":5.97}}`, number, number)
+	})
+	lat, lon, err := api.StreetCentroid(context.Background(), "6931XE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// numbers 2 to 4 are the samples
+	if math.Abs(lat-51.03) > 1e-9 || math.Abs(lon-5.97) > 1e-9 {
+		t.Errorf("centroid = %v, %v, want 51.03, 5.97", lat, lon)
+	}
+	if n := hits.Load(); n != centroidProbeSamples+1 {
+		t.Errorf("%d api requests, want %d", n, centroidProbeSamples+1)
+	}
+}
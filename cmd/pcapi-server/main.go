@@ -0,0 +1,206 @@
+// pcapi-server exposes the cached postcode api client over http, e.g. as a sidecar for non-go services.
+//
+// usage: POSTCODE_API_TOKEN=... pcapi-server [--addr :8080] [--cache file] [--ttl duration] [--retries n]
+//
+// flags default to the env vars PCAPI_ADDR, PCAPI_CACHE, PCAPI_TTL and PCAPI_RETRIES.
+//
+// endpoints:
+//
+//	GET /postcode/{postcode}/{number}  address as json, errors as {"error": "..."}
+//	GET /health                        200 while serving, 503 while shutting down
+//	GET /stats                         lookup counters, latency percentiles and api limits
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	postcodeapi "github.com/boomhut/postcode-api"
+)
+
+// max duration to finish running requests on shutdown
+const shutdownTimeout = 10 * time.Second
+
+func main() {
+	addr := flag.String("addr", envString("PCAPI_ADDR", ":8080"), "listen address")
+	cacheFile := flag.String("cache", envString("PCAPI_CACHE", postcodeapi.DefaultCacheFile), "cache file")
+	cacheTtl := flag.Duration("ttl", envDuration("PCAPI_TTL", postcodeapi.DefaultCacheTtl), "cache ttl")
+	retries := flag.Int("retries", envInt("PCAPI_RETRIES", 0), "retries for failed api requests")
+	flag.Parse()
+
+	// get token from env
+	api, err := postcodeapi.NewApiClientSettingsFromEnv(*cacheFile, *cacheTtl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	api.MaxRetries = *retries
+
+	s := &server{api: api}
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// stop on SIGINT / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", *addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		api.Close()
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	// graceful shutdown, finish running requests and close the cache
+	log.Println("shutting down")
+	s.stopping.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("http shutdown:", err)
+	}
+	if err := api.Shutdown(shutdownCtx); err != nil {
+		log.Println("cache shutdown:", err)
+	}
+}
+
+// struct for the http handlers, api is shared by all requests
+type server struct {
+	api      *postcodeapi.ApiClientSettings
+	stopping atomic.Bool
+}
+
+// function to get the http routes
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/postcode/", s.handlePostcode)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/stats", s.handleStats)
+	return mux
+}
+
+// GET /postcode/{postcode}/{number}
+func (s *server) handlePostcode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/postcode/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		writeError(w, http.StatusNotFound, "use /postcode/{postcode}/{number}")
+		return
+	}
+
+	info, err := s.api.GetPostcodeInfoContext(r.Context(), parts[0], parts[1])
+	if err != nil {
+		writeError(w, statusFor(err), err.Error())
+		return
+	}
+	writeJson(w, http.StatusOK, info)
+}
+
+// GET /health
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if s.stopping.Load() {
+		writeJson(w, http.StatusServiceUnavailable, map[string]string{"status": "stopping"})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GET /stats
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats := s.api.Stats()
+	writeJson(w, http.StatusOK, struct {
+		postcodeapi.Stats
+		HitRatio float64                   `json:"hitRatio"`
+		Latency  postcodeapi.LatencyStats  `json:"latency"`
+		Limits   postcodeapi.ApiLimitsInfo `json:"limits"`
+	}{stats, stats.HitRatio(), s.api.LatencyStats(), s.api.ApiLimits()})
+}
+
+// function to get the http status for a lookup error
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, postcodeapi.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, postcodeapi.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, postcodeapi.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, postcodeapi.ErrClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// function to write an error as json
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJson(w, status, map[string]string{"error": msg})
+}
+
+// function to write value as json
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+// function to get an env var or a default
+func envString(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// function to get a duration env var or a default
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return d
+}
+
+// function to get an int env var or a default
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return n
+}
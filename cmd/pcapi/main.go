@@ -0,0 +1,92 @@
+// pcapi looks up a dutch postcode / house number combination on the command line.
+//
+// usage: POSTCODE_API_TOKEN=... pcapi [--json] [--short] [--no-cache] [--cache file] [--ttl duration] postcode number
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	postcodeapi "github.com/boomhut/postcode-api"
+)
+
+func main() {
+	asJson := flag.Bool("json", false, "print the response as json")
+	short := flag.Bool("short", false, "print street and city only")
+	noCache := flag.Bool("no-cache", false, "don't read or write the cache file")
+	cacheFile := flag.String("cache", postcodeapi.DefaultCacheFile, "cache file")
+	cacheTtl := flag.Duration("ttl", postcodeapi.DefaultCacheTtl, "cache ttl")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: pcapi [flags] postcode number")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	postcode, number := flag.Arg(0), flag.Arg(1)
+
+	// use in-memory db when cache is disabled
+	if *noCache {
+		*cacheFile = ":memory:"
+	}
+	// get token from env
+	token := os.Getenv(postcodeapi.TokenEnvVar)
+	if token == "" {
+		fmt.Fprintln(os.Stderr, postcodeapi.ErrMissingToken)
+		os.Exit(2)
+	}
+	// fall back to an in-memory cache when another process (e.g. pcapi-server) holds the cache file
+	api, err := postcodeapi.OpenApiClientSettings(token, *cacheFile, *cacheTtl, func(api *postcodeapi.ApiClientSettings) {
+		api.InMemoryFallback = true
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// short lookup
+	if *short {
+		pis := api.GetPIS(postcode, number)
+		if pis == nil || pis.Street == "" {
+			fmt.Fprintln(os.Stderr, "not found")
+			os.Exit(1)
+		}
+		if *asJson {
+			printJson(pis)
+		} else {
+			fmt.Printf("%s, %s\n", pis.Street, pis.City)
+		}
+		return
+	}
+
+	// full lookup
+	info := api.GetPostcodeInfo(postcode, number)
+	if info == nil {
+		fmt.Fprintln(os.Stderr, "lookup failed")
+		os.Exit(1)
+	}
+	if *asJson {
+		printJson(info)
+	} else if info.Error == "" {
+		fmt.Printf("%s %d\n%s %s\n", info.Street, info.Number, info.Postcode, info.City)
+	}
+	if info.Error != "" {
+		fmt.Fprintln(os.Stderr, info.Error)
+		os.Exit(1)
+	}
+}
+
+// function to print value as indented json
+func printJson(v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(out))
+}
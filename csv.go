@@ -0,0 +1,189 @@
+package postcodeapi
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// default number of rows in flight when streaming a csv file
+const defaultCSVBufferSize = 256
+
+// struct for the options of ResolveCSVStream
+type CSVOptions struct {
+	PostcodeColumn int  // column index of the postcode
+	NumberColumn   int  // column index of the house number (both columns 0 = postcode in column 0, number in column 1)
+	Header         bool // the first row is a header, it is written with the added column names
+	Comma          rune // field delimiter (0 = ',')
+	Concurrency    int  // number of concurrent lookups (0 = BatchConcurrency)
+	BufferSize     int  // max rows read ahead and waiting for earlier rows (0 = 256), bounds memory
+}
+
+// columns added to every row
+var csvResultColumns = []string{"street", "city", "municipality", "province", "lat", "lon", "error"}
+
+// struct for a csv row in flight
+type csvRow struct {
+	seq      int
+	record   []string
+	response *ApiFullResponse
+	err      error
+}
+
+// function to resolve the postcode / number of every row of a csv file and write the rows with the address columns added
+// rows are streamed, so memory is bounded by BufferSize rows regardless of the file size, output is in input order
+// failed rows are written with the error column set, returns the number of written rows
+// returns ErrInvalidInput for negative column indexes, before anything is read
+func (api *ApiClientSettings) ResolveCSVStream(ctx context.Context, r io.Reader, w io.Writer, opts CSVOptions) (int, error) {
+	if opts.PostcodeColumn < 0 || opts.NumberColumn < 0 {
+		return 0, fmt.Errorf("%w: negative csv column index (postcode %d, number %d)", ErrInvalidInput, opts.PostcodeColumn, opts.NumberColumn)
+	}
+	if opts.PostcodeColumn == 0 && opts.NumberColumn == 0 {
+		opts.NumberColumn = 1
+	}
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultCSVBufferSize
+	}
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = api.BatchConcurrency
+	}
+	if workers <= 0 {
+		workers = defaultBatchConcurrency
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	writer := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		reader.Comma, writer.Comma = opts.Comma, opts.Comma
+	}
+
+	// header
+	if opts.Header {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := writer.Write(append(header, csvResultColumns...)); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// a slot is taken for every row read and given back when the row is written (backpressure)
+	slots := make(chan struct{}, bufferSize)
+	rows := make(chan csvRow)
+	results := make(chan csvRow)
+	var readErr error
+
+	// read rows
+	go func() {
+		defer close(rows)
+		for seq := 0; ; seq++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			record, err := reader.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+			select {
+			case rows <- csvRow{seq: seq, record: record}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// resolve rows
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range rows {
+				row.response, row.err = api.resolveCSVRecord(ctx, row.record, opts)
+				select {
+				case results <- row:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// write rows in input order
+	pending := make(map[int]csvRow)
+	next, written := 0, 0
+	for row := range results {
+		pending[row.seq] = row
+		for {
+			row, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if err := writer.Write(csvRecord(row)); err != nil {
+				return written, err
+			}
+			written++
+			<-slots
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return written, err
+	}
+	if err := ctx.Err(); err != nil {
+		return written, err
+	}
+	return written, readErr
+}
+
+// function to resolve the postcode / number of a csv record
+func (api *ApiClientSettings) resolveCSVRecord(ctx context.Context, record []string, opts CSVOptions) (*ApiFullResponse, error) {
+	if opts.PostcodeColumn >= len(record) || opts.NumberColumn >= len(record) {
+		return nil, fmt.Errorf("%w: missing postcode or number column", ErrInvalidInput)
+	}
+	return api.resolveItem(ctx, PostcodeNumber{Postcode: record[opts.PostcodeColumn], Number: record[opts.NumberColumn]})
+}
+
+// function to get the output record of a row, the input columns followed by csvResultColumns
+func csvRecord(row csvRow) []string {
+	record := row.record
+	if row.response != nil && row.response.outcome() == OutcomeOK {
+		r := row.response
+		return append(record, r.Street, r.City, r.Municipality, r.Province,
+			strconv.FormatFloat(r.Geo.Lat, 'f', -1, 64), strconv.FormatFloat(r.Geo.Lon, 'f', -1, 64), "")
+	}
+	message := "unknown error"
+	switch {
+	case row.err != nil && !errors.Is(row.err, ErrNotFound):
+		message = row.err.Error()
+	case row.response != nil:
+		message = row.response.Error
+	}
+	return append(record, "", "", "", "", "", "", message)
+}
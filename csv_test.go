@@ -0,0 +1,108 @@
+package postcodeapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveCSVStreamOrder(t *testing.T) {
+	const rowCount = 12
+	// later rows are answered first
+	api, _ := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.URL.Query().Get("number"))
+		time.Sleep(time.Duration(rowCount-number) * 2 * time.Millisecond)
+		fmt.Fprintf(w, `{"postcode":"6931XE","number":%d,"street":"Street %d","city":"Westervoort"}`, number, number)
+	})
+	var input strings.Builder
+	input.WriteString("postcode,number\n")
+	for i := 1; i <= rowCount; i++ {
+		fmt.Fprintf(&input, "6931XE,%d\n", i)
+	}
+
+	tests := []struct {
+		name string
+		opts CSVOptions
+	}{
+		{"default buffer", CSVOptions{Header: true, Concurrency: rowCount}},
+		{"small buffer", CSVOptions{Header: true, Concurrency: rowCount, BufferSize: 3}},
+		{"one worker", CSVOptions{Header: true, Concurrency: 1, BufferSize: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			written, err := api.ResolveCSVStream(context.Background(), strings.NewReader(input.String()), &out, tt.opts)
+			if err != nil || written != rowCount {
+				t.Fatalf("ResolveCSVStream() = %d, %v, want %d rows", written, err, rowCount)
+			}
+			records, err := csv.NewReader(&out).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != rowCount+1 {
+				t.Fatalf("%d output records, want %d", len(records), rowCount+1)
+			}
+			for i, record := range records[1:] {
+				number := strconv.Itoa(i + 1)
+				if record[1] != number || record[2] != "Street "+number {
+					t.Errorf("row %d = %v, want number %s", i, record, number)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveCSVStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the first row is answered, the others block until the stream is cancelled
+	api, _ := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		if number := r.URL.Query().Get("number"); number != "1" {
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(testAddressJson))
+	})
+	var input strings.Builder
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&input, "6931XE,%d\n", i)
+	}
+
+	var out bytes.Buffer
+	done := make(chan struct{})
+	var written int
+	var err error
+	go func() {
+		defer close(done)
+		written, err = api.ResolveCSVStream(ctx, strings.NewReader(input.String()), &out, CSVOptions{Concurrency: 4, BufferSize: 8})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ResolveCSVStream did not return after cancellation")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	// the rows written before the stream stopped are in input order, rows that were cancelled have the error set
+	records, _ := csv.NewReader(&out).ReadAll()
+	if written >= 1000 || len(records) != written {
+		t.Fatalf("%d rows written, %d output records, want less than 1000", written, len(records))
+	}
+	for i, record := range records {
+		if record[1] != strconv.Itoa(i+1) {
+			t.Errorf("row %d = %v, want number %d", i, record, i+1)
+		}
+		if i > 0 && record[len(record)-1] == "" {
+			t.Errorf("row %d = %v, want an error", i, record)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package postcodeapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// lookup failed without a usable api response (e.g. network error or invalid json)
+	ErrLookupFailed = errors.New("postcodeapi: lookup failed")
+
+	// api response body is not valid json (returned as *DecodeError)
+	ErrDecode = errors.New("postcodeapi: invalid json from api")
+
+	// invalid postcode or house number, no api request is made
+	ErrInvalidInput = errors.New("postcodeapi: invalid input")
+
+	// not in cache and ReadOnlyCache is set
+	ErrNotCached = errors.New("postcodeapi: not cached")
+
+	// not in cache and DryRun is set, the api request is only logged
+	ErrDryRunMiss = errors.New("postcodeapi: not cached (dry run)")
+
+	// the api has no coordinates for the address (see GetCoordinates)
+	ErrNoGeo = errors.New("postcodeapi: no coordinates for address")
+
+	// cache file is in use by another process (see InMemoryFallback)
+	ErrCacheLocked = errors.New("postcodeapi: cache file is locked by another process")
+
+	// client is shut down (see Shutdown)
+	ErrClosed = errors.New("postcodeapi: client is closed")
+
+	// cached value can't be decoded (only returned in StrictCache mode)
+	ErrCacheCorrupt = errors.New("postcodeapi: corrupt cache entry")
+
+	// api redirected to another host (the bearer token is not sent there) or too many times
+	ErrRedirected = errors.New("postcodeapi: api redirect not followed")
+
+	// bearer token env var is not set (see NewApiClientSettingsFromEnv)
+	ErrMissingToken = errors.New("postcodeapi: " + TokenEnvVar + " is not set")
+
+	// errors returned by the error-returning lookup methods (e.g. GetPostcodeInfoContext)
+	// the response is returned alongside these errors, so Outcome and Error can still be inspected
+	ErrNotFound     = errors.New("postcodeapi: unknown postcode / number combination")
+	ErrRateLimited  = errors.New("postcodeapi: too many requests")
+	ErrUnauthorized = errors.New("postcodeapi: unauthorized")
+	ErrUpstream     = errors.New("postcodeapi: api error")
+)
+
+// function to get the error for a lookup outcome (nil for OutcomeOK)
+func (o Outcome) err() error {
+	switch o {
+	case OutcomeOK:
+		return nil
+	case OutcomeNotFound:
+		return ErrNotFound
+	case OutcomeRateLimited:
+		return ErrRateLimited
+	case OutcomeUnauthorized:
+		return ErrUnauthorized
+	}
+	return ErrUpstream
+}
+
+// max length of the body snapshot in DecodeError
+const decodeErrorBodyLimit = 512
+
+// error for an api response that can't be decoded, includes a (truncated) snapshot of the body
+type DecodeError struct {
+	Err  error
+	Body string
+}
+
+// function to create a decode error with a truncated body snapshot
+func newDecodeError(err error, body []byte) *DecodeError {
+	if len(body) > decodeErrorBodyLimit {
+		body = append(body[:decodeErrorBodyLimit:decodeErrorBodyLimit], "..."...)
+	}
+	return &DecodeError{Err: err, Body: string(body)}
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v: %v (body: %q)", ErrDecode, e.Err, e.Body)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decode errors match ErrDecode and ErrLookupFailed
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrDecode || target == ErrLookupFailed
+}
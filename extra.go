@@ -0,0 +1,218 @@
+package postcodeapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// json keys of ApiFullResponse, everything else goes to Extra
+var knownResponseKeys = map[string]bool{
+	"postcode":     true,
+	"number":       true,
+	"street":       true,
+	"city":         true,
+	"municipality": true,
+	"province":     true,
+	"geo":          true,
+	"error":        true,
+	"outcome":      true,
+	"stale":        true,
+	"apiInfo":      true,
+	"alternatives": true,
+	"addition":     true,
+	"fetchedAt":    true,
+}
+
+// function to decode an api response body
+// a json array (several matches for the number) is decoded as its first match, with the others in Alternatives
+func decodeApiResponse(body []byte) (ApiFullResponse, error) {
+	var apiResponse ApiFullResponse
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		err := json.Unmarshal(body, &apiResponse)
+		return apiResponse, err
+	}
+	var matches []ApiFullResponse
+	if err := json.Unmarshal(body, &matches); err != nil {
+		return apiResponse, err
+	}
+	if len(matches) == 0 {
+		return apiResponse, errors.New("empty list of matches in api response")
+	}
+	apiResponse = matches[0]
+	apiResponse.Alternatives = matches[1:]
+	return apiResponse, nil
+}
+
+// function to decode the response, keeping unknown fields in Extra
+func (r *ApiFullResponse) UnmarshalJSON(data []byte) error {
+	// alias type without the UnmarshalJSON method
+	type apiFullResponse ApiFullResponse
+	var decoded struct {
+		apiFullResponse
+		Number json.RawMessage `json:"number"` // number or string, see parseNumber
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*r = ApiFullResponse(decoded.apiFullResponse)
+	number, addition, err := parseNumber(decoded.Number)
+	if err != nil {
+		return err
+	}
+	r.Number = number
+	if addition != "" {
+		r.Addition = addition
+	}
+
+	// collect unknown fields
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		if knownResponseKeys[key] {
+			continue
+		}
+		if r.Extra == nil {
+			r.Extra = make(map[string]json.RawMessage)
+		}
+		r.Extra[key] = value
+	}
+	return nil
+}
+
+// function to decode a house number given as json number (130) or string ("130" or "130A")
+// a letter addition in a string is returned separately
+func parseNumber(raw json.RawMessage) (int, string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, "", nil
+	}
+	if raw[0] != '"' {
+		var number json.Number
+		if err := json.Unmarshal(raw, &number); err != nil {
+			return 0, "", err
+		}
+		n, err := number.Int64()
+		return int(n), "", err
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, "", err
+	}
+	s = strings.TrimSpace(s)
+	digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	if digits == 0 {
+		if s == "" {
+			return 0, "", nil
+		}
+		return 0, "", fmt.Errorf("house number %q is not a number", s)
+	}
+	n, err := strconv.Atoi(s[:digits])
+	return n, strings.TrimLeft(s[digits:], " -"), err
+}
+
+// function to decode an unknown field from Extra into v, returns false if the field is not present
+func (r *ApiFullResponse) ExtraValue(key string, v any) (bool, error) {
+	value, ok := r.Extra[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(value, v)
+}
+
+// json keys of cache, besides the ApiFullResponse keys
+var cacheKeys = []string{"cached_at", "original_cached_at", "last_refreshed_at", "misses", "raw", "no_geo", "version", "ttl"}
+
+// function to decode a cache entry
+// needed because the UnmarshalJSON of the embedded ApiFullResponse would otherwise skip the cache fields
+func (c *cache) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		CachedAt         time.Time       `json:"cached_at"`
+		OriginalCachedAt time.Time       `json:"original_cached_at"`
+		LastRefreshedAt  time.Time       `json:"last_refreshed_at"`
+		Misses           int             `json:"misses"`
+		Raw              json.RawMessage `json:"raw"`
+		NoGeo            bool            `json:"no_geo"`
+		Version          int             `json:"version"`
+		Ttl              time.Duration   `json:"ttl"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if err := c.ApiFullResponse.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	c.CachedAt, c.Misses, c.Raw = fields.CachedAt, fields.Misses, fields.Raw
+	c.OriginalCachedAt, c.LastRefreshedAt = fields.OriginalCachedAt, fields.LastRefreshedAt
+	c.NoGeo, c.Version, c.Ttl = fields.NoGeo, fields.Version, fields.Ttl
+
+	// cache fields are not unknown api fields
+	for _, key := range cacheKeys {
+		delete(c.Extra, key)
+	}
+	if len(c.Extra) == 0 {
+		c.Extra = nil
+	}
+	return nil
+}
+
+// function to encode a cache entry, including the unknown fields in Extra (see PreserveUnknownFields)
+func (c cache) MarshalJSON() ([]byte, error) {
+	// alias type without the MarshalJSON method
+	type cacheEntry cache
+	data, err := json.Marshal(cacheEntry(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range c.Extra {
+		// known fields win over unknown fields of the same name
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// function to check that an api response has no unknown fields and has all required fields
+func (r *ApiFullResponse) validate() error {
+	if len(r.Extra) > 0 {
+		unknown := make([]string, 0, len(r.Extra))
+		for key := range r.Extra {
+			unknown = append(unknown, key)
+		}
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown fields in api response: %s", strings.Join(unknown, ", "))
+	}
+	var missing []string
+	if r.Postcode == "" {
+		missing = append(missing, "postcode")
+	}
+	if r.Number == 0 {
+		missing = append(missing, "number")
+	}
+	if r.Street == "" {
+		missing = append(missing, "street")
+	}
+	if r.City == "" {
+		missing = append(missing, "city")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing fields in api response: %s", strings.Join(missing, ", "))
+	}
+	for i := range r.Alternatives {
+		if err := r.Alternatives[i].validate(); err != nil {
+			return fmt.Errorf("alternative %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package postcodeapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUnmarshalNumber(t *testing.T) {
+	tests := []struct {
+		number       string
+		wantNumber   int
+		wantAddition string
+		wantErr      bool
+	}{
+		{`130`, 130, "", false},
+		{`"130"`, 130, "", false},
+		{`"130A"`, 130, "A", false},
+		{`"130-2"`, 130, "2", false},
+		{`" 130 a"`, 130, "a", false},
+		{`null`, 0, "", false},
+		{`""`, 0, "", false},
+		{`"A"`, 0, "", true},
+		{`130.5`, 0, "", true},
+		{`true`, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			var r ApiFullResponse
+			err := json.Unmarshal([]byte(`{"postcode":"6931XE","number":`+tt.number+`,"street":"Dorpsstraat"}`), &r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("no error for number %s", tt.number)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Number != tt.wantNumber || r.Addition != tt.wantAddition || r.Street != "Dorpsstraat" {
+				t.Errorf("got number %d addition %q street %q, want %d %q", r.Number, r.Addition, r.Street, tt.wantNumber, tt.wantAddition)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package postcodeapi
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// struct for geo coordinates of an address
+type Geo struct {
+	Lat float64 `json:"lat,omitempty"`
+	Lon float64 `json:"lon,omitempty"`
+}
+
+// struct for a GeoJSON feature
+type GeoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   GeoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// struct for a GeoJSON geometry
+type GeoJSONGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"` // [lon, lat]
+}
+
+// function to convert the response to a GeoJSON Point feature with the address as properties
+func (r *ApiFullResponse) ToGeoJSON() ([]byte, error) {
+	feature := GeoJSONFeature{
+		Type: "Feature",
+		Geometry: GeoJSONGeometry{
+			Type:        "Point",
+			Coordinates: []float64{r.Geo.Lon, r.Geo.Lat},
+		},
+		Properties: map[string]any{
+			"postcode":     r.Postcode,
+			"number":       r.Number,
+			"street":       r.Street,
+			"city":         r.City,
+			"municipality": r.Municipality,
+			"province":     r.Province,
+		},
+	}
+	return json.Marshal(feature)
+}
+
+// struct for a bounding box of geo coordinates
+type BoundingBox struct {
+	MinLat float64 `json:"minLat"`
+	MinLon float64 `json:"minLon"`
+	MaxLat float64 `json:"maxLat"`
+	MaxLon float64 `json:"maxLon"`
+}
+
+// meters per degree latitude (approximately)
+const metersPerDegree = 111320.0
+
+// function to check if the coordinates are set
+func (g Geo) IsZero() bool {
+	return g.Lat == 0 && g.Lon == 0
+}
+
+// mean earth radius in meters
+const earthRadius = 6371000.0
+
+// function to get the great-circle (haversine) distance in meters between two coordinates
+func DistanceBetween(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// function to sort responses in place by distance from lat / lon, nearest first
+// nil responses and responses without geo data sort last (in their original order)
+func SortByDistanceFrom(responses []*ApiFullResponse, lat, lon float64) {
+	distance := func(r *ApiFullResponse) float64 {
+		if r == nil || r.Geo.IsZero() {
+			return math.Inf(1)
+		}
+		return DistanceBetween(lat, lon, r.Geo.Lat, r.Geo.Lon)
+	}
+	sort.SliceStable(responses, func(i, j int) bool {
+		return distance(responses[i]) < distance(responses[j])
+	})
+}
+
+// function to get a bounding box of radius meters around the coordinates
+func (g Geo) BoundingBox(radius float64) BoundingBox {
+	dLat := radius / metersPerDegree
+	dLon := radius / (metersPerDegree * math.Cos(g.Lat*math.Pi/180))
+	return BoundingBox{MinLat: g.Lat - dLat, MinLon: g.Lon - dLon, MaxLat: g.Lat + dLat, MaxLon: g.Lon + dLon}
+}
+
+// function to get the bounding box of the coordinates of the responses
+// responses without geo data are skipped, returns false if there are none
+func BoundingBoxOf(responses []*ApiFullResponse) (BoundingBox, bool) {
+	var box BoundingBox
+	found := false
+	for _, r := range responses {
+		if r == nil || r.Geo.IsZero() {
+			continue
+		}
+		if !found {
+			box = BoundingBox{MinLat: r.Geo.Lat, MinLon: r.Geo.Lon, MaxLat: r.Geo.Lat, MaxLon: r.Geo.Lon}
+			found = true
+			continue
+		}
+		box.MinLat = math.Min(box.MinLat, r.Geo.Lat)
+		box.MinLon = math.Min(box.MinLon, r.Geo.Lon)
+		box.MaxLat = math.Max(box.MaxLat, r.Geo.Lat)
+		box.MaxLon = math.Max(box.MaxLon, r.Geo.Lon)
+	}
+	return box, found
+}
+
+// function to get a rough bounding box of a postcode from its cached numbers
+// a single cached number gives a box of radius meters around it, so accuracy depends on how many numbers are cached
+// returns ErrNotCached when no number of the postcode with geo data is cached
+func (api *ApiClientSettings) BoundingBox(postcode string, radius float64) (BoundingBox, error) {
+	responses, err := api.cachedNumbers(postcode)
+	if err != nil {
+		return BoundingBox{}, err
+	}
+	box, ok := BoundingBoxOf(responses)
+	if !ok {
+		return BoundingBox{}, ErrNotCached
+	}
+	// single point, use radius
+	if box.MinLat == box.MaxLat && box.MinLon == box.MaxLon {
+		return Geo{Lat: box.MinLat, Lon: box.MinLon}.BoundingBox(radius), nil
+	}
+	return box, nil
+}
+
+// function to get the cached (valid) responses of all numbers of a postcode from the buntdb cache
+func (api *ApiClientSettings) cachedNumbers(postcode string) ([]*ApiFullResponse, error) {
+	var responses []*ApiFullResponse
+	prefix := api.addressKey(postcode, "")
+	err := api.Cache.view(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", prefix, func(key, val string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			var value cache
+			if api.serializer().Unmarshal([]byte(val), &value) == nil && value.migrate() && value.outcome() == OutcomeOK {
+				responses = append(responses, &value.ApiFullResponse)
+			}
+			return true
+		})
+	})
+	return responses, err
+}
@@ -0,0 +1,77 @@
+package postcodeapi
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// interface for a geocoder that gets the coordinates of an address, defined by this package (not a library interface)
+// implemented by GeocoderAdapter, a geocoder with the same method can be swapped for it in an existing pipeline
+type Geocoder interface {
+	Geocode(address string) (lat, lon float64, err error)
+}
+
+// struct for a Geocoder on top of the cached client
+// only dutch addresses with a postcode and house number can be geocoded (the api covers the netherlands only),
+// other addresses return ErrInvalidInput so a pipeline can fall back to another geocoder
+type GeocoderAdapter struct {
+	api *ApiClientSettings
+}
+
+// make sure GeocoderAdapter implements Geocoder
+var _ Geocoder = (*GeocoderAdapter)(nil)
+
+// create new geocoder using the client (and its cache)
+func NewGeocoder(api *ApiClientSettings) *GeocoderAdapter {
+	return &GeocoderAdapter{api: api}
+}
+
+// function to get the coordinates of an address, see GeocodeContext
+func (g *GeocoderAdapter) Geocode(address string) (lat, lon float64, err error) {
+	return g.GeocodeContext(g.api.baseContext(), address)
+}
+
+// function to get the coordinates of a dutch address, e.g. "Dorpsstraat 12, 6931XE Westervoort" or "6931XE 12"
+// the street and city are ignored, the address is looked up by postcode and house number only
+// returns ErrInvalidInput without postcode or house number, ErrNotFound for unknown addresses and ErrNoGeo without coordinates
+func (g *GeocoderAdapter) GeocodeContext(ctx context.Context, address string) (lat, lon float64, err error) {
+	pair, err := parseAddress(address)
+	if err != nil {
+		return 0, 0, err
+	}
+	geo, err := g.api.GetCoordinates(ctx, pair.Postcode, pair.Number)
+	if err != nil {
+		return 0, 0, err
+	}
+	return geo.Lat, geo.Lon, nil
+}
+
+// regexes for a postcode and a house number (with optional addition) anywhere in an address
+var (
+	addressPostcodeRe = regexp.MustCompile(`\b[1-9][0-9]{3} ?[A-Za-z]{2}\b`)
+	addressNumberRe   = regexp.MustCompile(`\b([1-9][0-9]{0,4})[A-Za-z]{0,4}\b`)
+)
+
+// function to find the postcode and house number in a free form address
+// tries ParsePostcodeString first, otherwise takes the postcode and the last number in the rest of the address
+func parseAddress(address string) (PostcodeNumber, error) {
+	if pair, err := ParsePostcodeString(address); err == nil {
+		return pair, nil
+	}
+	postcode := addressPostcodeRe.FindString(address)
+	if postcode == "" {
+		return PostcodeNumber{}, fmt.Errorf("%w: no dutch postcode in address %q", ErrInvalidInput, address)
+	}
+	rest := strings.Replace(address, postcode, " ", 1)
+	numbers := addressNumberRe.FindAllStringSubmatch(rest, -1)
+	if len(numbers) == 0 {
+		return PostcodeNumber{}, fmt.Errorf("%w: no house number in address %q", ErrInvalidInput, address)
+	}
+	postcode = normalizePostcode(postcode)
+	if err := ValidatePostcode(postcode); err != nil {
+		return PostcodeNumber{}, err
+	}
+	return PostcodeNumber{Postcode: postcode, Number: numbers[len(numbers)-1][1]}, nil
+}
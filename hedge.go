@@ -0,0 +1,95 @@
+package postcodeapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// struct for the result of one of the hedged requests
+type hedgeResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// function to send a request, hedged with a second request when there is no response after HedgeDelay
+// the first successful response wins and the other request is cancelled
+// the hedged request waits for the throttle and counts as an api request
+func (api *ApiClientSettings) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if api.HedgeDelay <= 0 {
+		return api.do(req)
+	}
+
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	start := func(hedged bool) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			if hedged {
+				if err := api.shared().throttle.Wait(attemptCtx, api.RequestsPerMinute); err != nil {
+					results <- hedgeResult{index: index, err: err}
+					return
+				}
+				api.countStat(func(s *Stats) { s.ApiRequests++ })
+			}
+			resp, err := api.do(req.Clone(attemptCtx))
+			results <- hedgeResult{index: index, resp: resp, err: err}
+		}()
+	}
+
+	start(false)
+	timer := time.NewTimer(api.HedgeDelay)
+	defer timer.Stop()
+	pending := 1
+	var err error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			start(true)
+			pending++
+		case result := <-results:
+			pending--
+			if result.err != nil {
+				cancels[result.index]()
+				err = result.err
+				continue
+			}
+			// cancel the other request and discard its response in the background
+			for i, cancel := range cancels {
+				if i != result.index {
+					cancel()
+				}
+			}
+			go discardHedged(results, pending)
+			result.resp.Body = closeHook{ReadCloser: result.resp.Body, after: cancels[result.index]}
+			return result.resp, nil
+		}
+	}
+	return nil, err
+}
+
+// function to close the responses of cancelled hedged requests
+func discardHedged(results <-chan hedgeResult, pending int) {
+	for ; pending > 0; pending-- {
+		if result := <-results; result.resp != nil {
+			result.resp.Body.Close()
+		}
+	}
+}
+
+// struct for a response body that runs after when closed, e.g. to cancel the request context
+type closeHook struct {
+	io.ReadCloser
+	after func()
+}
+
+// function to close the body and run the hook
+func (b closeHook) Close() error {
+	err := b.ReadCloser.Close()
+	b.after()
+	return err
+}
@@ -0,0 +1,60 @@
+package postcodeapi
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgedRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		slowFirst bool
+		wantHits  int32
+	}{
+		{"fast first request", false, 1},
+		{"hedged request wins", true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var served atomic.Int32
+			loserCancelled := make(chan struct{})
+			api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+				if served.Add(1) == 1 && tt.slowFirst {
+					// the losing request is cancelled once the hedged request wins
+					select {
+					case <-r.Context().Done():
+						close(loserCancelled)
+					case <-time.After(5 * time.Second):
+					}
+					return
+				}
+				w.Write([]byte(testAddressJson))
+			})
+			api.HedgeDelay = 20 * time.Millisecond
+
+			info, err := api.GetPostcodeInfoContext(context.Background(), "6931XE", "130")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Street != "Dorpsstraat" {
+				t.Errorf("street = %q, want Dorpsstraat", info.Street)
+			}
+			if tt.slowFirst {
+				select {
+				case <-loserCancelled:
+				case <-time.After(5 * time.Second):
+					t.Error("losing request was not cancelled")
+				}
+			}
+			if n := hits.Load(); n != tt.wantHits {
+				t.Errorf("%d api requests, want %d", n, tt.wantHits)
+			}
+			if stats := api.Stats(); int32(stats.ApiRequests) != tt.wantHits {
+				t.Errorf("stats count %d api requests, want %d", stats.ApiRequests, tt.wantHits)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package postcodeapi
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+)
+
+// struct for an lru of decoded address entries in front of the cache db (see HotCacheSize)
+// saves the db read and decoding of every cache hit for hot keys
+type hotCache struct {
+	mu      sync.Mutex
+	order   *list.List               // most recently used first
+	entries map[string]*list.Element // key -> element with a *hotEntry
+}
+
+// struct for an lru element
+type hotEntry struct {
+	key   string
+	value cache
+}
+
+// function to get a deep copy of a decoded entry, so callers can modify it
+func (h *hotCache) get(key string) (*cache, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	element, ok := h.entries[key]
+	if !ok {
+		return nil, false
+	}
+	h.order.MoveToFront(element)
+	value := element.Value.(*hotEntry).value.clone()
+	return &value, true
+}
+
+// function to keep a copy of a decoded entry, evicting the least recently used entry when size is reached
+func (h *hotCache) put(key string, value cache, size int) {
+	value = value.clone()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.entries == nil {
+		h.order = list.New()
+		h.entries = make(map[string]*list.Element)
+	}
+	if element, ok := h.entries[key]; ok {
+		element.Value.(*hotEntry).value = value
+		h.order.MoveToFront(element)
+		return
+	}
+	h.entries[key] = h.order.PushFront(&hotEntry{key: key, value: value})
+	for h.order.Len() > size {
+		oldest := h.order.Back()
+		h.order.Remove(oldest)
+		delete(h.entries, oldest.Value.(*hotEntry).key)
+	}
+}
+
+// function to drop an entry after it was written or deleted
+func (h *hotCache) remove(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if element, ok := h.entries[key]; ok {
+		h.order.Remove(element)
+		delete(h.entries, key)
+	}
+}
+
+// function to drop all entries, after bulk changes of the cache db (e.g. PruneOlderThan)
+func (h *hotCache) clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.order, h.entries = nil, nil
+}
+
+// function to deep copy a cache entry, so the lru and its callers never share slices or maps
+func (c cache) clone() cache {
+	c.ApiFullResponse = c.ApiFullResponse.clone()
+	c.Raw = cloneBytes(c.Raw)
+	return c
+}
+
+// function to deep copy a response, including its alternatives and unknown fields
+func (r ApiFullResponse) clone() ApiFullResponse {
+	if r.Extra != nil {
+		extra := make(map[string]json.RawMessage, len(r.Extra))
+		for key, value := range r.Extra {
+			extra[key] = cloneBytes(value)
+		}
+		r.Extra = extra
+	}
+	if r.Alternatives != nil {
+		alternatives := make([]ApiFullResponse, len(r.Alternatives))
+		for i := range r.Alternatives {
+			alternatives[i] = r.Alternatives[i].clone()
+		}
+		r.Alternatives = alternatives
+	}
+	r.raw = cloneBytes(r.raw)
+	return r
+}
+
+// function to copy a byte slice, nil stays nil
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
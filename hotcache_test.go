@@ -0,0 +1,89 @@
+package postcodeapi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHotCacheEviction(t *testing.T) {
+	var h hotCache
+	h.put("a", cache{ApiFullResponse: ApiFullResponse{Street: "a"}}, 2)
+	h.put("b", cache{ApiFullResponse: ApiFullResponse{Street: "b"}}, 2)
+
+	// using a makes b the least recently used entry
+	if _, ok := h.get("a"); !ok {
+		t.Fatal("a not found")
+	}
+	h.put("c", cache{ApiFullResponse: ApiFullResponse{Street: "c"}}, 2)
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	}
+	for _, tt := range tests {
+		if _, ok := h.get(tt.key); ok != tt.want {
+			t.Errorf("get(%q) found = %v, want %v", tt.key, ok, tt.want)
+		}
+	}
+
+	h.remove("a")
+	if _, ok := h.get("a"); ok {
+		t.Error("a found after remove")
+	}
+	h.clear()
+	if _, ok := h.get("c"); ok {
+		t.Error("c found after clear")
+	}
+}
+
+func TestHotCacheGetReturnsCopy(t *testing.T) {
+	var h hotCache
+	value := cache{ApiFullResponse: ApiFullResponse{
+		Street:       "Dorpsstraat",
+		Extra:        map[string]json.RawMessage{"x": json.RawMessage(`1`)},
+		Alternatives: []ApiFullResponse{{Street: "Kerkstraat"}},
+	}}
+	h.put("k", value, 1)
+
+	// changes to the stored value and to a returned copy don't reach the lru
+	value.Extra["x"] = json.RawMessage(`2`)
+	got, _ := h.get("k")
+	got.Street = "changed"
+	got.Extra["x"][0] = '9'
+	got.Extra["y"] = json.RawMessage(`3`)
+	got.Alternatives[0].Street = "changed"
+
+	again, _ := h.get("k")
+	if again.Street != "Dorpsstraat" || string(again.Extra["x"]) != "1" || len(again.Extra) != 1 || again.Alternatives[0].Street != "Kerkstraat" {
+		t.Errorf("lru entry changed through a copy: %+v", again.ApiFullResponse)
+	}
+}
+
+// function to benchmark cached lookups of one address with an lru of size hotCacheSize
+func benchmarkCacheHit(b *testing.B, hotCacheSize int) {
+	api := NewApiClientSettings("token", b.TempDir()+"/cache.db", time.Hour)
+	defer api.Close()
+	api.HotCacheSize = hotCacheSize
+	api.saveCached("6931XE", "130", &ApiFullResponse{
+		Postcode: "6931XE", Number: 130, Street: "Dorpsstraat", City: "Westervoort",
+		Municipality: "Westervoort", Province: "Gelderland", Geo: Geo{Lat: 51.96, Lon: 5.97}, Outcome: OutcomeOK,
+	})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := api.GetPostcodeInfoContext(ctx, "6931XE", "130"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCacheHitDb(b *testing.B)  { benchmarkCacheHit(b, 0) }
+func BenchmarkCacheHitLRU(b *testing.B) { benchmarkCacheHit(b, 100) }
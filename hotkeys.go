@@ -0,0 +1,117 @@
+package postcodeapi
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// default max number of keys counted by TrackHotKeys
+const defaultHotKeysCapacity = 1000
+
+// struct for the number of lookups of a postcode / number combination
+type KeyCount struct {
+	Key   string `json:"key"` // "postcode number", the WarmFromFile format (e.g. "6931XE 130")
+	Count int64  `json:"count"`
+}
+
+// struct for bounded lookup counters using the space saving algorithm
+// when full, a new key replaces the least counted key and inherits its count, so frequent keys are kept
+// the counters are kept in a min-heap, so recording a key is O(log capacity)
+type hotKeys struct {
+	mu    sync.Mutex
+	items map[string]*hotKey
+	heap  hotKeyHeap
+}
+
+// struct for the counter of a key in the heap
+type hotKey struct {
+	key   string
+	count int64
+	index int // position in the heap
+}
+
+// type for a min-heap of counters, least counted first (see container/heap)
+type hotKeyHeap []*hotKey
+
+func (h hotKeyHeap) Len() int           { return len(h) }
+func (h hotKeyHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hotKeyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *hotKeyHeap) Push(x any) {
+	item := x.(*hotKey)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *hotKeyHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// function to count a lookup of key, keeping at most capacity keys
+func (h *hotKeys) record(key string, capacity int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.items == nil {
+		h.items = make(map[string]*hotKey)
+	}
+	if item, ok := h.items[key]; ok {
+		item.count++
+		heap.Fix(&h.heap, item.index)
+		return
+	}
+	if len(h.heap) < capacity {
+		item := &hotKey{key: key, count: 1}
+		heap.Push(&h.heap, item)
+		h.items[key] = item
+		return
+	}
+	// replace the least counted key
+	item := h.heap[0]
+	delete(h.items, item.key)
+	item.key = key
+	item.count++
+	h.items[key] = item
+	heap.Fix(&h.heap, 0)
+}
+
+// function to count a lookup for TopKeys, if TrackHotKeys is set
+func (api *ApiClientSettings) recordHotKey(postcode string, number string) {
+	if !api.TrackHotKeys {
+		return
+	}
+	capacity := api.HotKeysCapacity
+	if capacity <= 0 {
+		capacity = defaultHotKeysCapacity
+	}
+	api.hotKeys.record(postcode+" "+number, capacity)
+}
+
+// function to get the n most looked up postcode / number combinations since start, most looked up first
+// needs TrackHotKeys, only HotKeysCapacity keys are counted so counts of keys that replaced another key can be too high
+func (api *ApiClientSettings) TopKeys(n int) []KeyCount {
+	h := &api.hotKeys
+	h.mu.Lock()
+	top := make([]KeyCount, 0, len(h.heap))
+	for _, item := range h.heap {
+		top = append(top, KeyCount{Key: item.key, Count: item.count})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	if n >= 0 && n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
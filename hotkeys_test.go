@@ -0,0 +1,22 @@
+package postcodeapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHotKeysSpaceSaving(t *testing.T) {
+	api := &ApiClientSettings{TrackHotKeys: true, HotKeysCapacity: 2}
+	for _, number := range []string{"1", "1", "1", "2", "2", "3"} {
+		api.recordHotKey("6931XE", number)
+	}
+
+	// 3 replaced 2, the least counted key, and inherited its count
+	want := []KeyCount{{Key: "6931XE 1", Count: 3}, {Key: "6931XE 3", Count: 3}}
+	if got := api.TopKeys(-1); !reflect.DeepEqual(got, want) {
+		t.Errorf("TopKeys() = %v, want %v", got, want)
+	}
+	if got := api.TopKeys(1); len(got) != 1 || got[0].Key != "6931XE 1" {
+		t.Errorf("TopKeys(1) = %v", got)
+	}
+}
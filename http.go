@@ -0,0 +1,200 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default connection pool settings, tuned for sustained requests to the single api host
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// function to get the http client, creating a pooled client from the settings on first use
+// a HttpClient without CheckRedirect is used with the redirect policy of checkRedirect, its own CheckRedirect is respected
+func (api *ApiClientSettings) httpClient() *http.Client {
+	if api.HttpClient != nil {
+		if api.HttpClient.CheckRedirect != nil {
+			return api.HttpClient
+		}
+		api.clientOnce.Do(func() {
+			client := *api.HttpClient
+			client.CheckRedirect = checkRedirect
+			api.client = &client
+		})
+		return api.client
+	}
+	api.clientOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = api.MaxIdleConns
+		transport.MaxIdleConnsPerHost = api.MaxIdleConnsPerHost
+		transport.IdleConnTimeout = api.IdleConnTimeout
+		api.client = &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+	})
+	return api.client
+}
+
+// default query parameter names for the lookup
+const (
+	defaultPostcodeParam = "postcode"
+	defaultNumberParam   = "number"
+)
+
+// function to get the url of the full lookup (see Routes)
+func (api *ApiClientSettings) lookupURL(postcode string, number string) string {
+	return api.routeURL(RouteFull, map[string]string{"postcode": normalizePostcode(postcode), "number": number})
+}
+
+// function to send a single http request, waiting for a MaxInFlight slot
+// the slot is released when the response body is closed
+func (api *ApiClientSettings) do(req *http.Request) (*http.Response, error) {
+	if api.MaxInFlight <= 0 {
+		return api.httpClient().Do(req)
+	}
+	limits := api.shared()
+	limits.inFlightOnce.Do(func() {
+		limits.inFlight = make(chan struct{}, api.MaxInFlight)
+	})
+	select {
+	case limits.inFlight <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	var release sync.Once
+	releaseSlot := func() { release.Do(func() { <-limits.inFlight }) }
+	resp, err := api.httpClient().Do(req)
+	if err != nil {
+		releaseSlot()
+		return nil, err
+	}
+	resp.Body = closeHook{ReadCloser: resp.Body, after: releaseSlot}
+	return resp, nil
+}
+
+// function to prepare an authenticated lookup request
+func (api *ApiClientSettings) newRequest(ctx context.Context, postcode string, number string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", api.lookupURL(postcode, number), nil)
+	if err != nil {
+		err = api.redactError(err)
+		log.Println(err)
+		return nil, fmt.Errorf("%w: %w", ErrLookupFailed, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+api.ApiBearerToken)
+	// an empty User-Agent omits the header (instead of sending go's default)
+	req.Header.Set("User-Agent", api.UserAgent)
+	return req, nil
+}
+
+// max number of redirects to follow
+const maxRedirects = 10
+
+// function to follow same host redirects with the Authorization header
+// redirects to another host or from https to http return ErrRedirected, so the bearer token is never sent there
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrRedirected, maxRedirects)
+	}
+	if req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("%w: %s moved to %s", ErrRedirected, via[0].URL.Host, req.URL.Host)
+	}
+	if via[0].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("%w: %s moved to %s", ErrRedirected, via[0].URL.Scheme, req.URL.Scheme)
+	}
+	req.Header.Set("Authorization", via[0].Header.Get("Authorization"))
+	return nil
+}
+
+// query parameters that are always masked, in case a token ends up in the endpoint url
+var secretQueryParams = []string{"token", "access_token", "api_key", "apikey", "key"}
+
+// function to mask the token and (with RedactQueryParams) all other query values in a url before it is logged
+func (api *ApiClientSettings) redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(unparsable url)"
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	query := u.Query()
+	for name := range query {
+		if api.RedactQueryParams || isSecretQueryParam(name) {
+			query.Set(name, "REDACTED")
+		}
+	}
+	u.RawQuery = query.Encode()
+	if api.ApiBearerToken != "" {
+		return strings.ReplaceAll(u.String(), api.ApiBearerToken, "REDACTED")
+	}
+	return u.String()
+}
+
+// function to check if a query parameter holds a secret
+func isSecretQueryParam(name string) bool {
+	for _, secret := range secretQueryParams {
+		if strings.EqualFold(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// function to redact the url of a request error (which embeds the full url) before it is logged or returned
+func (api *ApiClientSettings) redactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = api.redactURL(urlErr.URL)
+	}
+	return err
+}
+
+// postcode / number used to check the token
+const (
+	tokenCheckPostcode = "6931XE"
+	tokenCheckNumber   = "1"
+)
+
+// function to check if the api accepts the token, e.g. to fail fast on misconfiguration at startup
+// makes a single lookup request (no retries, nothing is cached), returns false without error when the token is rejected (401 / 403)
+// other failures (network errors, 429, 5xx) return an error, because the token could not be checked
+func (api *ApiClientSettings) ValidateToken(ctx context.Context) (bool, error) {
+	req, err := api.newRequest(ctx, tokenCheckPostcode, tokenCheckNumber)
+	if err != nil {
+		return false, err
+	}
+	if api.DryRun {
+		log.Println("dry run, not checking token:", api.redactURL(req.URL.String()))
+		return false, ErrDryRunMiss
+	}
+	if err := api.shared().throttle.Wait(ctx, api.RequestsPerMinute); err != nil {
+		return false, err
+	}
+	api.countStat(func(s *Stats) { s.ApiRequests++ })
+	resp, err := api.do(req)
+	if err != nil {
+		api.countStat(func(s *Stats) { s.ApiErrors++ })
+		return false, fmt.Errorf("%w: %w", ErrLookupFailed, api.redactError(err))
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound:
+		return true, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return false, fmt.Errorf("%w: token not checked", ErrRateLimited)
+	default:
+		api.countStat(func(s *Stats) { s.ApiErrors++ })
+		return false, fmt.Errorf("%w: token not checked (status %d)", ErrUpstream, resp.StatusCode)
+	}
+}
@@ -0,0 +1,92 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		via     int
+		wantErr bool
+	}{
+		{"same host", "https://postcode.tech/api/v1/postcode/full", "https://postcode.tech/api/v2/postcode/full", 1, false},
+		{"same host http", "http://localhost/a", "http://localhost/b", 1, false},
+		{"http to https", "http://postcode.tech/a", "https://postcode.tech/a", 1, false},
+		{"other host", "https://postcode.tech/a", "https://example.com/a", 1, true},
+		{"other port", "https://postcode.tech/a", "https://postcode.tech:8443/a", 1, true},
+		{"https to http", "https://postcode.tech/a", "http://postcode.tech/a", 1, true},
+		{"too many redirects", "https://postcode.tech/a", "https://postcode.tech/b", maxRedirects, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, _ := http.NewRequest(http.MethodGet, tt.from, nil)
+			first.Header.Set("Authorization", "Bearer token")
+			via := make([]*http.Request, tt.via)
+			for i := range via {
+				via[i] = first
+			}
+			next, _ := http.NewRequest(http.MethodGet, tt.to, nil)
+
+			err := checkRedirect(next, via)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("checkRedirect() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrRedirected) {
+				t.Errorf("checkRedirect() error = %v, want ErrRedirected", err)
+			}
+			if err == nil && next.Header.Get("Authorization") != "Bearer token" {
+				t.Error("Authorization header not kept on same host redirect")
+			}
+		})
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request sent to other host, Authorization = %q", r.Header.Get("Authorization"))
+	}))
+	defer other.Close()
+
+	tests := []struct {
+		name       string
+		httpClient *http.Client
+		location   string
+		wantErr    error
+	}{
+		{"same host", nil, "/moved/postcode/full", nil},
+		{"other host", nil, other.URL + "/postcode/full", ErrRedirected},
+		{"custom client, other host", &http.Client{Timeout: time.Second}, other.URL + "/postcode/full", ErrRedirected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, _ := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.URL.Path, "/moved/") {
+					http.Redirect(w, r, tt.location, http.StatusFound)
+					return
+				}
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("Authorization = %q after redirect", r.Header.Get("Authorization"))
+				}
+				w.Write([]byte(testAddressJson))
+			})
+			api.HttpClient = tt.httpClient
+
+			_, err := api.GetPostcodeInfoContext(context.Background(), "6931XE", "130")
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("lookup error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("lookup error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package postcodeapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// cache keys are namespaced, so address entries can never collide with api limits info
+const (
+	addressKeyPrefix  = "pc:"
+	metaKeyPrefix     = "meta:"
+	geoKeyPrefix      = "geo:"
+	centroidKeyPrefix = "centroid:"
+
+	namespaceKeyPrefix = "ns:" // followed by the namespace and ":", see WithNamespace
+
+	apiInfoKey         = metaKeyPrefix + "api_info"
+	apiInfoCachedAtKey = metaKeyPrefix + "api_info_cached_at"
+	keysMigratedKey    = metaKeyPrefix + "keys_migrated"
+)
+
+// prefix of the cache keys of the namespace, empty for the default namespace
+func (api *ApiClientSettings) namespacePrefix() string {
+	if api.Namespace == "" {
+		return ""
+	}
+	return namespaceKeyPrefix + api.Namespace + ":"
+}
+
+// prefix of the address keys of the namespace
+func (api *ApiClientSettings) addressKeyPrefix() string {
+	return api.namespacePrefix() + addressKeyPrefix
+}
+
+// cache key for postcode / number combination, "6931 xe" and "6931XE" share a key
+func (api *ApiClientSettings) addressKey(postcode string, number string) string {
+	return api.addressKeyPrefix() + normalizePostcode(postcode) + number
+}
+
+// cache key for postcode level entries
+func (api *ApiClientSettings) postcodeKey(postcode string) string {
+	return api.addressKeyPrefix() + "postcode:" + normalizePostcode(postcode)
+}
+
+// cache key for reverse lookups, coordinates rounded to precision decimals
+func (api *ApiClientSettings) geoKey(lat, lon float64, precision int) string {
+	return fmt.Sprintf("%s%s%.*f,%.*f", api.namespacePrefix(), geoKeyPrefix, precision, lat, precision, lon)
+}
+
+// cache key for the street centroid of a postcode
+func (api *ApiClientSettings) centroidKey(postcode string) string {
+	return api.namespacePrefix() + centroidKeyPrefix + normalizePostcode(postcode)
+}
+
+// function to check if a key is used for api limits info, reverse lookups or centroids instead of an address entry
+func isInternalKey(key string) bool {
+	return strings.HasPrefix(key, metaKeyPrefix) || strings.HasPrefix(key, geoKeyPrefix) || strings.HasPrefix(key, centroidKeyPrefix)
+}
+
+// function to check if a db still has keys from before namespacing, see migrateKeys
+func hasLegacyKeys(db *buntdb.DB) bool {
+	migrated := true
+	db.View(func(tx *buntdb.Tx) error {
+		_, err := tx.Get(keysMigratedKey)
+		migrated = err != buntdb.ErrNotFound
+		return nil
+	})
+	return !migrated
+}
+
+// function to move keys from before namespacing (e.g. "6931XE130" and "api_info") to their namespace
+// runs once per db, rate limit history from before namespacing is dropped
+func migrateKeys(db *buntdb.DB) error {
+	return db.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get(keysMigratedKey); err == nil {
+			return nil
+		}
+		// collect old keys, keys can't be changed while iterating
+		var keys, values []string
+		err := tx.Ascend("", func(key, val string) bool {
+			if !strings.HasPrefix(key, addressKeyPrefix) && !strings.HasPrefix(key, namespaceKeyPrefix) && !isInternalKey(key) {
+				keys = append(keys, key)
+				values = append(values, val)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+			switch {
+			case strings.HasPrefix(key, "api_info_history:"):
+				continue
+			case strings.HasPrefix(key, "api_info"):
+				_, _, err = tx.Set(metaKeyPrefix+key, values[i], nil)
+			default:
+				_, _, err = tx.Set(addressKeyPrefix+key, values[i], nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		_, _, err = tx.Set(keysMigratedKey, "1", nil)
+		return err
+	})
+}
@@ -0,0 +1,118 @@
+package postcodeapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// function to write a cache file with the keys from before namespacing
+func writeLegacyCache(t *testing.T, path string, cachedAt time.Time) {
+	t.Helper()
+	db, err := buntdb.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *buntdb.Tx) error {
+		for key, val := range map[string]string{
+			"6931XE130":          `{"postcode":"6931XE","number":130,"street":"Dorpsstraat","city":"Westervoort","cached_at":"` + cachedAt.Format(time.RFC3339) + `"}`,
+			"api_info":           `{"max_requests_per_day":1000,"remaining_requests_today":900}`,
+			"api_info_cached_at": cachedAt.Format(time.RFC3339),
+			"api_info_history:0": `{"max_requests_per_day":1000,"remaining_requests_today":950}`,
+		} {
+			if _, _, err := tx.Set(key, val, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// function to get the keys of a cache file
+func fileKeys(t *testing.T, path string) map[string]bool {
+	t.Helper()
+	db, err := buntdb.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	keys := make(map[string]bool)
+	db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, val string) bool {
+			keys[key] = true
+			return true
+		})
+	})
+	return keys
+}
+
+func TestLegacyKeys(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected api request %s", r.URL)
+	}))
+	defer srv.Close()
+	cachedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		readOnly bool
+		wantKeys []string
+		wantGone []string
+	}{
+		{
+			name:     "read-only fallback",
+			readOnly: true,
+			wantKeys: []string{"6931XE130", "api_info", "api_info_cached_at", "api_info_history:0"},
+			wantGone: []string{keysMigratedKey},
+		},
+		{
+			name:     "migrated",
+			wantKeys: []string{addressKeyPrefix + "6931XE130", apiInfoKey, apiInfoCachedAtKey, keysMigratedKey},
+			wantGone: []string{"6931XE130", "api_info", "api_info_cached_at", "api_info_history:0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/cache.db"
+			writeLegacyCache(t, path, cachedAt)
+
+			api := NewApiClientSettingsLazy("token", path, time.Hour)
+			api.ApiEndpoint = srv.URL + "/"
+			api.ReadOnlyCache = tt.readOnly
+			info, err := api.GetPostcodeInfoContext(context.Background(), "6931XE", "130")
+			if err != nil {
+				t.Fatalf("lookup error = %v", err)
+			}
+			if info.Street != "Dorpsstraat" {
+				t.Errorf("street = %q, want Dorpsstraat", info.Street)
+			}
+			if limits := api.ApiLimits(); limits.RemainingRequestsToday != 900 {
+				t.Errorf("remaining requests today = %d, want 900", limits.RemainingRequestsToday)
+			}
+			if at := api.GetCachingTime(); !at.Equal(cachedAt) {
+				t.Errorf("caching time = %v, want %v", at, cachedAt)
+			}
+			api.Close()
+
+			keys := fileKeys(t, path)
+			for _, key := range tt.wantKeys {
+				if !keys[key] {
+					t.Errorf("key %q missing", key)
+				}
+			}
+			for _, key := range tt.wantGone {
+				if keys[key] {
+					t.Errorf("key %q not expected", key)
+				}
+			}
+		})
+	}
+}
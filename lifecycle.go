@@ -0,0 +1,86 @@
+package postcodeapi
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// struct for background work (async lookups and streams), so Shutdown can wait for it
+type lifecycle struct {
+	mu       sync.Mutex
+	closing  bool
+	closed   atomic.Bool   // set by Close, checked on every lookup
+	stopping chan struct{} // closed when Shutdown starts
+	tasks    sync.WaitGroup
+}
+
+// function to get a channel that is closed when Shutdown starts
+func (l *lifecycle) stopped() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stoppingChan()
+}
+
+// function to get the stopping channel, l.mu must be held
+func (l *lifecycle) stoppingChan() chan struct{} {
+	if l.stopping == nil {
+		l.stopping = make(chan struct{})
+	}
+	return l.stopping
+}
+
+// function to check if Close was called
+func (l *lifecycle) isClosed() bool {
+	return l.closed.Load()
+}
+
+// function to run fn in a background goroutine, returns false (without running fn) after Shutdown
+func (api *ApiClientSettings) goBackground(fn func()) bool {
+	l := &api.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return false
+	}
+	l.tasks.Add(1)
+	go func() {
+		defer l.tasks.Done()
+		fn()
+	}()
+	return true
+}
+
+// function to stop accepting background work, wait for running work and close the cache
+// if ctx is done first, ctx.Err() is returned and the cache is left open for the remaining work
+func (api *ApiClientSettings) Shutdown(ctx context.Context) error {
+	l := &api.lifecycle
+	l.mu.Lock()
+	if !l.closing {
+		l.closing = true
+		close(l.stoppingChan())
+	}
+	l.mu.Unlock()
+
+	// wait for background work
+	drained := make(chan struct{})
+	go func() {
+		l.tasks.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return api.Close()
+}
+
+// function to close the cache db, lookups after Close fail
+func (api *ApiClientSettings) Close() error {
+	api.lifecycle.closed.Store(true)
+
+	err := api.Cache.close()
+	api.unlockCacheFile()
+	return err
+}
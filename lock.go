@@ -0,0 +1,42 @@
+package postcodeapi
+
+import (
+	"fmt"
+	"os"
+)
+
+// function to take an exclusive lock on the cache file, so a second process gets ErrCacheLocked
+// instead of writing to the same file (buntdb doesn't lock the file itself)
+// the lock is held on a separate .lock file, because compacting replaces the cache file
+func (api *ApiClientSettings) lockCacheFile(path string) error {
+	if path == ":memory:" {
+		return nil
+	}
+	f, err := lockPath(path)
+	if err != nil {
+		return err
+	}
+	api.cacheLock = f
+	return nil
+}
+
+// function to take the exclusive lock of a cache file, close the returned file to release it
+func lockPath(path string) (*os.File, error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s: %w", ErrCacheLocked, path, err)
+	}
+	return f, nil
+}
+
+// function to release the lock on the cache file
+func (api *ApiClientSettings) unlockCacheFile() {
+	if api.cacheLock != nil {
+		api.cacheLock.Close()
+		api.cacheLock = nil
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package postcodeapi
+
+import "os"
+
+// function to lock f, not supported on this platform, so the cache file is not locked
+func lockFile(f *os.File) error {
+	return nil
+}
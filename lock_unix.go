@@ -0,0 +1,13 @@
+//go:build unix
+
+package postcodeapi
+
+import (
+	"os"
+	"syscall"
+)
+
+// function to lock f without waiting, fails when another process holds the lock
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package postcodeapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMergeCacheFileInUse(t *testing.T) {
+	dir := t.TempDir()
+	other := NewApiClientSettings("token", dir+"/other.db", time.Hour)
+	defer other.Close()
+	api := NewApiClientSettings("token", dir+"/cache.db", time.Hour)
+	defer api.Close()
+	if _, err := api.MergeCacheFile(other.CachePath()); !errors.Is(err, ErrCacheLocked) {
+		t.Errorf("merge of a file in use error = %v, want ErrCacheLocked", err)
+	}
+}
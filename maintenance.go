@@ -0,0 +1,228 @@
+package postcodeapi
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// function to delete all cached address entries older than age from the buntdb cache
+// returns the number of deleted entries, api limits info is kept
+func (api *ApiClientSettings) PruneOlderThan(age time.Duration) (int, error) {
+	cutoff := time.Now().Add(-age)
+	return api.pruneWhere(func(value *cache) bool {
+		return value.CachedAt.Before(cutoff)
+	})
+}
+
+// function to delete all cached address entries that are past their ttl (CacheDecision ttl or CacheTtl)
+// returns the number of deleted entries, api limits info is kept
+func (api *ApiClientSettings) pruneExpired() (int, error) {
+	now := time.Now()
+	return api.pruneWhere(func(value *cache) bool {
+		return now.Sub(value.CachedAt) >= api.entryTtl(value)
+	})
+}
+
+// function to delete the cached address entries for which expired returns true
+func (api *ApiClientSettings) pruneWhere(expired func(value *cache) bool) (int, error) {
+	deleted := 0
+	err := api.Cache.update(func(tx *buntdb.Tx) error {
+		// collect old keys, keys can't be deleted while iterating
+		var keys []string
+		prefix := api.addressKeyPrefix()
+		err := tx.AscendGreaterOrEqual("", prefix, func(key, val string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			var value cache
+			if api.serializer().Unmarshal([]byte(val), &value) == nil && expired(&value) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	api.hotCache.clear()
+	return deleted, err
+}
+
+// function to count cached address entries in the buntdb cache (api limits info is not counted)
+// only iterates the address keys, values are not decoded
+func (api *ApiClientSettings) CacheEntryCount() (int, error) {
+	count := 0
+	prefix := api.addressKeyPrefix()
+	err := api.Cache.view(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", prefix, func(key, val string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			count++
+			return true
+		})
+	})
+	return count, err
+}
+
+// function to import the address entries of another cache file into the buntdb cache
+// on conflicts the entry with the newest CachedAt is kept, returns the number of imported entries
+// the other file must exist and must not be in use by another client (ErrCacheLocked)
+func (api *ApiClientSettings) MergeCacheFile(otherPath string) (int, error) {
+	// buntdb.Open would create a missing file
+	if _, err := os.Stat(otherPath); err != nil {
+		return 0, err
+	}
+	lock, err := lockPath(otherPath)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Close()
+	other, err := buntdb.Open(otherPath)
+	if err != nil {
+		return 0, err
+	}
+	defer other.Close()
+
+	// read address entries, keys from before namespacing are namespaced here
+	entries := make(map[string]string)
+	err = other.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, val string) bool {
+			switch {
+			case strings.HasPrefix(key, addressKeyPrefix), strings.HasPrefix(key, namespaceKeyPrefix):
+				entries[key] = val
+			case !isInternalKey(key) && !strings.HasPrefix(key, "api_info"):
+				entries[addressKeyPrefix+key] = val
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	merged := 0
+	err = api.Cache.update(func(tx *buntdb.Tx) error {
+		for key, val := range entries {
+			var incoming cache
+			if api.serializer().Unmarshal([]byte(val), &incoming) != nil {
+				continue
+			}
+			// keep existing entry if it is newer
+			if current, err := tx.Get(key); err == nil {
+				var existing cache
+				if api.serializer().Unmarshal([]byte(current), &existing) == nil && !incoming.CachedAt.After(existing.CachedAt) {
+					continue
+				}
+			}
+			if _, _, err := tx.Set(key, val, nil); err != nil {
+				return err
+			}
+			merged++
+		}
+		return nil
+	})
+	api.hotCache.clear()
+	return merged, err
+}
+
+// function to compact the cache file by rewriting it without deleted and expired entries
+// the file is rewritten in the background by buntdb, lookups continue meanwhile
+func (api *ApiClientSettings) Compact() error {
+	db, err := api.Cache.db()
+	if err != nil {
+		return err
+	}
+	if api.CachePath() == ":memory:" {
+		return nil
+	}
+	return db.Shrink()
+}
+
+// function to prune entries past their ttl (see CacheDecision) and compact the cache file every interval in the background
+// runs until ctx is done or Shutdown, returns false (without starting) after Shutdown or when interval is not positive
+// pruning removes the expired entries ServeStaleOnError could serve, compacting briefly needs disk space for a copy of the file
+func (api *ApiClientSettings) StartMaintenance(ctx context.Context, interval time.Duration) bool {
+	if interval <= 0 {
+		return false
+	}
+	stopped := api.lifecycle.stopped()
+	return api.goBackground(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopped:
+				return
+			case <-ticker.C:
+				// read-only caches are left as they are
+				if api.ReadOnlyCache {
+					continue
+				}
+				if pruned, err := api.pruneExpired(); err != nil {
+					log.Println("cache maintenance:", err)
+				} else if pruned > 0 {
+					log.Printf("cache maintenance: pruned %d entries", pruned)
+				}
+				if err := api.Compact(); err != nil {
+					log.Println("cache maintenance:", err)
+				}
+			}
+		}
+	})
+}
+
+// function to check that every cached entry can be decoded, e.g. at startup to detect a damaged db early
+// returns the keys of corrupt entries, which are deleted when DeleteCorruptCache is set (and not ReadOnlyCache)
+// reverse lookup and centroid keys and rate limit info other than the current api limits info are not checked
+func (api *ApiClientSettings) VerifyCache() ([]string, error) {
+	var corrupt []string
+	err := api.Cache.view(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, val string) bool {
+			var err error
+			switch {
+			case key == apiInfoKey:
+				var info ApiLimitsInfo
+				err = api.serializer().Unmarshal([]byte(val), &info)
+			case isInternalKey(key), strings.Contains(key, ":"+geoKeyPrefix), strings.Contains(key, ":"+centroidKeyPrefix):
+				return true
+			default:
+				var value cache
+				err = api.serializer().Unmarshal([]byte(val), &value)
+			}
+			if err != nil {
+				corrupt = append(corrupt, key)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(corrupt) > 0 && api.DeleteCorruptCache && !api.ReadOnlyCache {
+		err = api.Cache.update(func(tx *buntdb.Tx) error {
+			for _, key := range corrupt {
+				if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+					return err
+				}
+			}
+			return nil
+		})
+		api.hotCache.clear()
+	}
+	return corrupt, err
+}
@@ -0,0 +1,40 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestMergeCacheFile(t *testing.T) {
+	source, _ := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAddressJson))
+	})
+	if _, err := source.GetPostcodeInfoContext(context.Background(), "6931XE", "130"); err != nil {
+		t.Fatal(err)
+	}
+	sourcePath := source.CachePath()
+	source.Close()
+
+	api, _ := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unexpected request", http.StatusInternalServerError)
+	})
+	missing := t.TempDir() + "/missing.db"
+	if _, err := api.MergeCacheFile(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("merge of a missing file error = %v, want os.ErrNotExist", err)
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("merge created the missing file")
+	}
+
+	merged, err := api.MergeCacheFile(sourcePath)
+	if err != nil || merged != 1 {
+		t.Fatalf("MergeCacheFile() = %d, %v, want 1 entry", merged, err)
+	}
+	api.ReadOnlyCache = true
+	if _, err := api.GetPostcodeInfoContext(context.Background(), "6931XE", "130"); err != nil {
+		t.Errorf("merged entry lookup error = %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package postcodeapi
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/buntdb"
+)
+
+// function to get a client for a namespace (e.g. a tenant) that shares the cache db and http client
+// the cached entries of a namespace are separate from those of other namespaces (and the default namespace "")
+// the options are copied, stats and api limits info are kept per client
+// throttling, MaxInFlight slots, the retry budget and reservations are shared with the parent, so tenants can't exceed them together
+// close the parent client only, closing a namespaced client closes the shared cache db
+func (api *ApiClientSettings) WithNamespace(namespace string) *ApiClientSettings {
+	sub := &ApiClientSettings{}
+	// copy the exported options, the unexported state (locks, stats) starts fresh
+	src, dst := reflect.ValueOf(api).Elem(), reflect.ValueOf(sub).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if src.Type().Field(i).IsExported() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	sub.ApiInfo, sub.apiInfoAt = api.limitsAt()
+	sub.HttpClient = api.httpClient()
+	sub.limits = api.shared()
+	sub.Cache.api = sub
+	sub.Namespace = namespace
+	return sub
+}
+
+// struct for the limiters of a client, shared with its namespaced clients
+type sharedLimits struct {
+	throttle    limiter
+	retryBudget tokenBucket
+
+	inFlightOnce sync.Once
+	inFlight     chan struct{} // semaphore for MaxInFlight
+
+	reservedMu sync.Mutex
+	reserved   int // reserved requests of the daily budget (see Reserve)
+}
+
+// function to get the limiters of the client, shared with its namespaced clients
+func (api *ApiClientSettings) shared() *sharedLimits {
+	api.limitsOnce.Do(func() {
+		if api.limits == nil {
+			api.limits = &sharedLimits{}
+		}
+	})
+	return api.limits
+}
+
+// function to delete all cached entries of the namespace of the client (see WithNamespace)
+// returns the number of deleted entries, api limits info is kept
+func (api *ApiClientSettings) ClearNamespace() (int, error) {
+	addressPrefix := api.addressKeyPrefix()
+	geoPrefix := api.namespacePrefix() + geoKeyPrefix
+	centroidPrefix := api.namespacePrefix() + centroidKeyPrefix
+	deleted := 0
+	err := api.Cache.update(func(tx *buntdb.Tx) error {
+		// collect keys, keys can't be deleted while iterating
+		var keys []string
+		for _, prefix := range []string{addressPrefix, geoPrefix, centroidPrefix} {
+			err := tx.AscendGreaterOrEqual("", prefix, func(key, val string) bool {
+				if !strings.HasPrefix(key, prefix) {
+					return false
+				}
+				keys = append(keys, key)
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	api.hotCache.clear()
+	return deleted, err
+}
@@ -0,0 +1,59 @@
+// Package otelpostcode traces postcode-api lookups and api requests with OpenTelemetry.
+//
+// It is a separate module (github.com/boomhut/postcode-api/otelpostcode), so the postcode-api
+// module doesn't need the OpenTelemetry dependencies otherwise:
+//
+//	api.Tracer = otelpostcode.NewTracer(otel.GetTracerProvider())
+package otelpostcode
+
+import (
+	"context"
+	"fmt"
+
+	postcodeapi "github.com/boomhut/postcode-api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation name of the tracer
+const instrumentationName = "github.com/boomhut/postcode-api"
+
+// struct for a postcodeapi.Tracer using an OpenTelemetry tracer
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// function to get a postcodeapi.Tracer that creates spans with the tracer provider
+func NewTracer(tp trace.TracerProvider) postcodeapi.Tracer {
+	return tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// function to start a span, ended with the attributes and error of the operation
+func (t tracer) Start(ctx context.Context, name string) (context.Context, func(attrs map[string]any, err error)) {
+	ctx, span := t.tracer.Start(ctx, name)
+	return ctx, func(attrs map[string]any, err error) {
+		for key, value := range attrs {
+			span.SetAttributes(toAttribute(key, value))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// function to convert an attribute value to an OpenTelemetry attribute
+func toAttribute(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
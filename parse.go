@@ -0,0 +1,113 @@
+package postcodeapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// function to parse a postcode and house number from user input, e.g. "6931XE130" or "6931 xe, 130a"
+// the postcode is returned normalized (uppercase, no space), house number additions are dropped (see ParsePostcodeStringWithAddition)
+//
+// accepted grammar (surrounding whitespace is ignored):
+//
+//	input     = postcode separator number [addition]
+//	postcode  = digit1-9 3digit [" "] 2letter   ; letters in any case, not SA / SD / SS
+//	separator = *(" " / "," / "-")
+//	number    = digit1-9 *4digit
+//	addition  = [" " / "-"] 1*4(letter / digit)
+//
+// accepted formats:
+//
+//	6931XE130     6931XE 130     6931 XE 130    6931xe130
+//	6931XE, 130   6931XE-130     6931XE 130A    6931XE 130-2
+//
+// returns ErrInvalidInput for anything else
+func ParsePostcodeString(s string) (PostcodeNumber, error) {
+	pn, _, err := ParsePostcodeStringWithAddition(s)
+	return pn, err
+}
+
+// function to parse a postcode, house number and addition from user input, see ParsePostcodeString
+// the addition is returned uppercase without separator (e.g. "A" for "6931XE 130a"), empty when there is none
+func ParsePostcodeStringWithAddition(s string) (PostcodeNumber, string, error) {
+	p := parser{input: strings.TrimSpace(s)}
+	invalid := func(reason string) (PostcodeNumber, string, error) {
+		return PostcodeNumber{}, "", fmt.Errorf("%w: %q is not a postcode and number (%s)", ErrInvalidInput, s, reason)
+	}
+
+	// postcode
+	digits := p.take(isDigit, 4)
+	if len(digits) != 4 || digits[0] == '0' {
+		return invalid("postcode must start with 4 digits, not starting with 0")
+	}
+	p.skip(" ", 1)
+	letters := p.take(isLetter, 2)
+	if len(letters) != 2 {
+		return invalid("postcode must end with 2 letters")
+	}
+	postcode := digits + strings.ToUpper(letters)
+	if err := ValidatePostcode(postcode); err != nil {
+		return PostcodeNumber{}, "", err
+	}
+
+	// number
+	p.skip(" ,-", len(p.input))
+	number := p.take(isDigit, 5)
+	if number == "" || number[0] == '0' {
+		return invalid("missing house number")
+	}
+	if p.done() {
+		return PostcodeNumber{Postcode: postcode, Number: number}, "", nil
+	}
+	if p.peekIsDigit() {
+		return invalid("house number too long")
+	}
+
+	// addition
+	p.skip(" -", 1)
+	addition := p.take(func(c byte) bool { return isLetter(c) || isDigit(c) }, 4)
+	if addition == "" || !p.done() {
+		return invalid("invalid house number addition")
+	}
+	return PostcodeNumber{Postcode: postcode, Number: number}, strings.ToUpper(addition), nil
+}
+
+// struct for a cursor over ascii input
+type parser struct {
+	input string
+	pos   int
+}
+
+// function to consume up to max bytes matching ok
+func (p *parser) take(ok func(byte) bool, max int) string {
+	start := p.pos
+	for p.pos < len(p.input) && p.pos-start < max && ok(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// function to consume up to max bytes from set
+func (p *parser) skip(set string, max int) {
+	p.take(func(c byte) bool { return strings.IndexByte(set, c) >= 0 }, max)
+}
+
+// function to check if all input is consumed
+func (p *parser) done() bool {
+	return p.pos == len(p.input)
+}
+
+// function to check if the next byte is a digit
+func (p *parser) peekIsDigit() bool {
+	return p.pos < len(p.input) && isDigit(p.input[p.pos])
+}
+
+// function to check if c is an ascii digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// function to check if c is an ascii letter
+func isLetter(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
@@ -0,0 +1,92 @@
+package postcodeapi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePostcodeString(t *testing.T) {
+	tests := []struct {
+		input        string
+		wantPostcode string
+		wantNumber   string
+		wantAddition string
+		wantErr      bool
+	}{
+		{"6931XE130", "6931XE", "130", "", false},
+		{"6931XE 130", "6931XE", "130", "", false},
+		{"6931 XE 130", "6931XE", "130", "", false},
+		{"6931xe130", "6931XE", "130", "", false},
+		{"6931XE, 130", "6931XE", "130", "", false},
+		{"6931XE-130", "6931XE", "130", "", false},
+		{"6931XE 130A", "6931XE", "130", "A", false},
+		{"6931XE 130-2", "6931XE", "130", "2", false},
+		{"6931 xe, 130a", "6931XE", "130", "A", false},
+		{"  6931XE 130  ", "6931XE", "130", "", false},
+		{"1000AA 99999", "1000AA", "99999", "", false},
+
+		{"", "", "", "", true},
+		{"6931XE", "", "", "", true},
+		{"0931XE 130", "", "", "", true},
+		{"693XE 130", "", "", "", true},
+		{"6931X 130", "", "", "", true},
+		{"6931XEE 130", "", "", "", true},
+		{"6931SA 130", "", "", "", true},
+		{"6931XE 0", "", "", "", true},
+		{"6931XE 123456", "", "", "", true},
+		{"6931XE 130 ABCDE", "", "", "", true},
+		{"6931XE 130A!", "", "", "", true},
+		{"SW1A 1AA 10", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			pn, addition, err := ParsePostcodeStringWithAddition(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidInput) {
+					t.Fatalf("error = %v, want ErrInvalidInput", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if pn.Postcode != tt.wantPostcode || pn.Number != tt.wantNumber || addition != tt.wantAddition {
+				t.Errorf("got %q %q %q, want %q %q %q", pn.Postcode, pn.Number, addition, tt.wantPostcode, tt.wantNumber, tt.wantAddition)
+			}
+			if short, err := ParsePostcodeString(tt.input); err != nil || short != pn {
+				t.Errorf("ParsePostcodeString() = %v, %v, want %v", short, err, pn)
+			}
+		})
+	}
+}
+
+func FuzzParsePostcodeString(f *testing.F) {
+	for _, seed := range []string{"6931XE130", "6931 xe, 130a", "6931XE 130-2", "6931XE-130", "0931XE 1", "6931SA 130", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		pn, addition, err := ParsePostcodeStringWithAddition(input)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Fatalf("error %v is not ErrInvalidInput", err)
+			}
+			return
+		}
+		if err := ValidatePostcode(pn.Postcode); err != nil || pn.Postcode != normalizePostcode(pn.Postcode) {
+			t.Fatalf("postcode %q is not a normalized dutch postcode", pn.Postcode)
+		}
+		if err := (&ApiClientSettings{}).ValidateHouseNumber(pn.Number); err != nil {
+			t.Fatalf("number %q: %v", pn.Number, err)
+		}
+
+		// the parsed parts format back to the same result
+		formatted := pn.Postcode + " " + pn.Number
+		if addition != "" {
+			formatted += "-" + addition
+		}
+		again, againAddition, err := ParsePostcodeStringWithAddition(formatted)
+		if err != nil || again != pn || againAddition != addition {
+			t.Fatalf("%q parsed to %v %q, %q parsed to %v %q (%v)", input, pn, addition, formatted, again, againAddition, err)
+		}
+	})
+}
@@ -1,25 +1,233 @@
 package postcodeapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"regexp"
-	"strconv"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/tidwall/buntdb"
 )
 
 // struct for api settings
+// safe for concurrent use, one client can be shared by all handlers of a http server
+// set the options before the first lookup and read ApiInfo through ApiLimits while lookups are running
 type ApiClientSettings struct {
 	ApiEndpoint    string
 	ApiBearerToken string
+	UserAgent      string // empty = no User-Agent header
 	ApiInfo        ApiLimitsInfo
 	Cache          cacheDb
+	AddressCache   Cache // cache for address entries, nil = Cache (e.g. NewTieredCache(&api.Cache, remote))
 	CacheTtl       time.Duration
 	CacheFile      string
+
+	// store street/city/geo once per postcode and only the number specific bits per number
+	// numbers that are not cached yet are served from the postcode level entry (no geo accuracy per number)
+	PostcodeLevelCache bool
+
+	// return ErrRateLimited without an api request when the last known limits are exhausted
+	FailFastWhenRateLimited bool
+
+	// corrupt cache entries are re-fetched by default
+	// StrictCache returns ErrCacheCorrupt instead, DeleteCorruptCache removes them from the cache
+	StrictCache        bool
+	DeleteCorruptCache bool
+
+	// keep rate limit snapshots in the cache for RateLimitHistory
+	KeepRateLimitHistory bool
+
+	// only read from the cache, misses return ErrNotCached and no api requests or cache writes are made
+	// the cache file is not locked, so e.g. a reporting process can read the cache of a running server
+	ReadOnlyCache bool
+
+	// fields of a response to store in the cache, e.g. FieldStreet | FieldCity (0 = all fields)
+	// geo is stored anyway once GetCoordinates is used
+	StoreFields Fields
+
+	// hook to post-process successfully fetched responses before they are cached (e.g. normalize casing)
+	// set TransformOnCacheHit to also run it on responses served from cache
+	Transform           func(*ApiFullResponse)
+	TransformOnCacheHit bool
+
+	// double the time a not found result is cached for every repeated not found lookup (up to CacheTtl)
+	NegativeTtlBackoff bool
+
+	// store the api response body in the cache for GetPostcodeInfoRaw
+	StoreRawResponse bool
+
+	// keep unknown fields (Extra) in cache entries, so fields of a newer api or package version survive a rewrite of the entry
+	// only applies to the JSONSerializer, by default unknown fields are dropped when an entry is written
+	PreserveUnknownFields bool
+
+	// function to decide per api response if it is cached and for how long (ttl 0 = CacheTtl), nil = cache everything for CacheTtl
+	// e.g. to cache low quality matches shortly, read fields the api may add (e.g. a confidence) with ExtraValue
+	CacheDecision func(apiResponse *ApiFullResponse) (store bool, ttl time.Duration)
+
+	// number of decoded address entries kept in memory in front of the cache db, for hot keys (0 = off)
+	// cache hits of these entries skip the db read and decoding, the entries are dropped when written through this client
+	// writes to a shared cache by other processes are only seen after eviction (entries stay valid until their ttl)
+	HotCacheSize int
+
+	// client side throttling, max api requests per minute (0 = no throttling)
+	// waiting for the throttle stops when the request context is done
+	RequestsPerMinute int
+
+	// context for methods without a ctx argument (e.g. GetPostcodeInfo), nil = context.Background()
+	BaseContext context.Context
+
+	// http client for api requests, nil = pooled client using the settings below (set before the first request)
+	// a client without CheckRedirect only follows same host redirects without https to http downgrade (see ErrRedirected)
+	HttpClient          *http.Client
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// serve expired cache entries (with Stale set) when the api request fails, e.g. during an outage
+	ServeStaleOnError bool
+
+	// number of concurrent lookups in batch methods (0 = 4)
+	BatchConcurrency int
+
+	// mask all query values (postcode, number) in logged urls and returned errors, secrets are always masked
+	RedactQueryParams bool
+
+	// keep the api limits info (api_info) in memory only, instead of storing it in the cache db so it survives restarts
+	// e.g. for many short-lived clients sharing a db
+	DisableRateLimitPersistence bool
+
+	// prefix for the cache keys of this client, to separate tenants sharing one cache db (empty = default namespace)
+	// set before the first lookup, see WithNamespace
+	Namespace string
+
+	// tracer for lookups and api requests (nil = no tracing), see the otelpostcode package for OpenTelemetry
+	Tracer Tracer
+
+	// encoding of cache values, nil = JSONSerializer (set before the first lookup, existing entries are not converted)
+	Serializer Serializer
+
+	// use an in-memory cache when the cache file is locked by another process, instead of failing with ErrCacheLocked
+	InMemoryFallback bool
+
+	// how often the cache file is synced to disk (default SyncDefault = buntdb's EverySecond)
+	// SyncAlways is safest, SyncNever / SyncEverySecond trade durability for write throughput
+	SyncPolicy SyncPolicy
+
+	// never call the api, lookups that miss the cache are logged and return ErrDryRunMiss (e.g. for staging)
+	DryRun bool
+
+	// never call the api from GetPIS, short lookups only use the cache (a short lookup costs a full request)
+	ShortLookupCacheOnly bool
+
+	// max duration of a single lookup in batch methods, a timed out item gets a context.DeadlineExceeded error (0 = no limit)
+	BatchItemTimeout time.Duration
+
+	// function called by batch methods after every completed lookup, e.g. to render a progress bar
+	// calls are serialized, nil = no callback
+	ProgressFunc func(done, total int)
+
+	// reject api responses with unknown fields or missing required fields (as DecodeError)
+	// to detect changes of the api contract early, by default unknown fields are kept in Extra
+	StrictDecode bool
+
+	// upper bound for house numbers (0 = 99999)
+	MaxHouseNumber int
+
+	// soft cap for CacheTtl, a larger ttl is capped and logged once (0 = no cap)
+	MaxCacheTtl time.Duration
+
+	// number of retries for failed api requests (0 = no retries)
+	// the delay before a retry starts at RetryBackoff (0 = 500ms) and doubles for every next retry
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	// retry budget shared by all requests, max retries in a burst (0 = no budget, every request may retry MaxRetries times)
+	// regained at RetryBudgetPerMinute retries per minute (0 = RetryBudget per minute), when used up failed requests aren't retried
+	RetryBudget          int
+	RetryBudgetPerMinute int
+
+	// query parameter names for the lookup, for compatible mirrors or api versions (empty = "postcode" / "number")
+	PostcodeParam string
+	NumberParam   string
+
+	// path templates per lookup type relative to ApiEndpoint, e.g. to target a mirror with other paths (missing = default path)
+	// placeholders: {postcode} and {number}, e.g. map[Route]string{RouteFull: "v2/address/{postcode}/{number}"}
+	Routes map[Route]string
+
+	// number of decimals lat / lon are rounded to for GetByCoordinates cache keys (0 = 4, ~10m)
+	GeoCachePrecision int
+
+	// ttl of cached StreetCentroid results (0 = 24h)
+	CentroidTtl time.Duration
+
+	// after a found lookup, fetch the numbers up to NeighborRange (0 = 5) below and above it in the background
+	// so the next lookups in an address form are served from cache, prefetch requests count towards the api limits
+	PrefetchNeighbors bool
+	NeighborRange     int
+
+	// count lookups per postcode / number combination in memory for TopKeys, e.g. to pick entries to warm
+	// at most HotKeysCapacity (0 = 1000) combinations are counted
+	TrackHotKeys    bool
+	HotKeysCapacity int
+
+	// names of the rate limit headers, for compatible apis using other names (empty = postcode.tech headers)
+	RateLimitHeaderMap RateLimitHeaderMap
+
+	// max number of concurrent api requests of this client, across all callers and batches (0 = no limit)
+	// requests wait for a free slot, a slot is held until the response body is read
+	MaxInFlight int
+
+	// send a second api request when the first has no response after HedgeDelay, the first response wins (0 = no hedging)
+	// lowers tail latency at the cost of extra api requests, the second request waits for the throttle
+	HedgeDelay time.Duration
+
+	// function to decide if an api request is retried, statusCode is 0 when err is set
+	// nil = DefaultRetryPredicate (network errors and 5xx)
+	RetryPredicate func(statusCode int, err error) bool
+
+	ttlWarning sync.Once
+	apiInfoMu  sync.RWMutex
+	apiInfoAt  time.Time        // time of the last api limits info update
+	budget     []budgetSnapshot // snapshots of the remaining daily budget (see BurnRate)
+	inflight   flightGroup
+	statsMu    sync.Mutex
+	stats      Stats
+	clientOnce sync.Once
+	client     *http.Client
+	lifecycle  lifecycle
+	latency    latencyRing
+
+	prefetching prefetchSet
+	hotKeys     hotKeys
+	hotCache    hotCache
+
+	limitsOnce sync.Once
+	limits     *sharedLimits // throttle, MaxInFlight slots, retry budget and reservations, see shared
+	cacheLock  *os.File      // lock on the cache file, see lockCacheFile
+	keepGeo    atomic.Bool   // GetCoordinates was used, store geo also when StoreFields leaves it out
+	legacyKeys bool          // read-only cache from before namespacing, see migrateKeys
 }
 
+// defaults for api endpoint, cache file and cache ttl
+const (
+	DefaultEndpoint  = "https://postcode.tech/api/v1/"
+	DefaultCacheFile = "./data/pcapi_cache.db"
+	DefaultCacheTtl  = 30 * 24 * time.Hour // suggested ttl, the constructors use the ttl that is passed
+)
+
+// default soft cap for CacheTtl
+const defaultMaxCacheTtl = 365 * 24 * time.Hour
+
+// default user agent
+const defaultUserAgent = "sw-core/2.0"
+
 // struct for api limits info
 type ApiLimitsInfo struct {
 	MaxRequestsPerMinute   int `json:"max_requests_per_minute"`  // get from api response header X-RateLimit-Limit
@@ -29,6 +237,18 @@ type ApiLimitsInfo struct {
 
 }
 
+// function to get the api limits info as json struct, received at the given time
+func (info ApiLimitsInfo) withTime(at time.Time) ApiLimitInfoJson {
+	return ApiLimitInfoJson{
+		MaxRequestsPerMinute:   info.MaxRequestsPerMinute,
+		RemainingRequests:      info.RemainingRequests,
+		MaxRequestsPerDay:      info.MaxRequestsPerDay,
+		RemainingRequestsToday: info.RemainingRequestsToday,
+		CachingTime:            at,
+		TimeSinceLastCache:     time.Duration(time.Since(at).Seconds()),
+	}
+}
+
 // struct for api response (short)
 type ApiShortResponse struct {
 	Street string `json:"street"`
@@ -37,18 +257,61 @@ type ApiShortResponse struct {
 
 // struct for 'full' api response
 type ApiFullResponse struct {
-	Postcode     string `json:"postcode,omitempty"`
-	Number       int    `json:"number,omitempty"`
-	Street       string `json:"street,omitempty"`
-	City         string `json:"city,omitempty"`
-	Municipality string `json:"municipality,omitempty"`
-	Province     string `json:"province,omitempty"`
-	Geo          struct {
-		Lat float64 `json:"lat,omitempty"`
-		Lon float64 `json:"lon,omitempty"`
-	} `json:"geo,omitempty"`
-	Error   string           `json:"error,omitempty"`
-	ApiInfo ApiLimitInfoJson `json:"apiInfo,omitempty"`
+	Postcode     string           `json:"postcode,omitempty"`
+	Number       int              `json:"number,omitempty"`
+	Addition     string           `json:"addition,omitempty"` // letter addition, when the api returns the number as string (e.g. "130A")
+	Street       string           `json:"street,omitempty"`
+	City         string           `json:"city,omitempty"`
+	Municipality string           `json:"municipality,omitempty"`
+	Province     string           `json:"province,omitempty"`
+	Geo          Geo              `json:"geo,omitempty"`
+	Error        string           `json:"error,omitempty"`
+	Outcome      Outcome          `json:"outcome,omitempty"`
+	Stale        bool             `json:"stale,omitempty"` // expired cache entry served because the api request failed
+	FetchedAt    time.Time        `json:"fetchedAt"`       // time the data was received from the api (CachedAt when served from cache)
+	ApiInfo      ApiLimitInfoJson `json:"apiInfo,omitempty"`
+
+	// other matches when the api returns several addresses for the number (e.g. split buildings)
+	Alternatives []ApiFullResponse `json:"alternatives,omitempty"`
+
+	// fields returned by the api that are not in this struct (see ExtraValue)
+	Extra map[string]json.RawMessage `json:"-"`
+
+	raw []byte // api response body
+}
+
+// type for the outcome of a lookup, so callers don't have to match on the Error string
+type Outcome string
+
+const (
+	OutcomeOK            Outcome = "ok"             // address found
+	OutcomeNotFound      Outcome = "not_found"      // postcode / number combination unknown (404)
+	OutcomeRateLimited   Outcome = "rate_limited"   // too many requests (429)
+	OutcomeUnauthorized  Outcome = "unauthorized"   // bearer token rejected (401)
+	OutcomeUpstreamError Outcome = "upstream_error" // any other api error
+)
+
+// human readable Error messages, only for display: detect a not found or rate limited response by its Outcome
+const (
+	notFoundMessage    = "unknown combination"
+	rateLimitedMessage = "too many requests"
+)
+
+// function to derive the outcome for responses cached before Outcome existed
+// the only place the Error message is matched, cache entries get their Outcome on read (see cache.migrate)
+func (r *ApiFullResponse) outcome() Outcome {
+	if r.Outcome != "" {
+		return r.Outcome
+	}
+	switch r.Error {
+	case "":
+		return OutcomeOK
+	case notFoundMessage:
+		return OutcomeNotFound
+	case rateLimitedMessage:
+		return OutcomeRateLimited
+	}
+	return OutcomeUpstreamError
 }
 
 // struct to output api limit info as json
@@ -62,52 +325,136 @@ type ApiLimitInfoJson struct {
 }
 
 // create new apiClientSettings with cache
+// exits the program when the cache can't be opened (e.g. ErrCacheLocked), use OpenApiClientSettings to handle that
 func NewApiClientSettings(apiBearerToken string, cacheFile string, cacheTtl time.Duration) *ApiClientSettings {
+	api := newApiClientSettings(apiBearerToken, cacheFile, cacheTtl)
 
-	// apiEndpoint = "https://postcode.tech/api/v1/" // default api endpoint
-	apiEndpoint := "https://postcode.tech/api/v1/"
+	// set cachedb
+	api.Cache = api.InitDb()
 
-	api := &ApiClientSettings{
-		ApiEndpoint:    apiEndpoint,
-		ApiBearerToken: apiBearerToken,
-		CacheTtl:       cacheTtl,
-		CacheFile:      cacheFile,
+	// get api limits info from cache
+	api.GetFromCache()
+
+	return api
+
+}
+
+// create new apiClientSettings with cache, calling configure (if not nil) before the cache is opened
+// so options that affect opening (e.g. InMemoryFallback, SyncPolicy, ReadOnlyCache) can be set, open errors are returned
+func OpenApiClientSettings(apiBearerToken string, cacheFile string, cacheTtl time.Duration, configure func(api *ApiClientSettings)) (*ApiClientSettings, error) {
+	api := newApiClientSettings(apiBearerToken, cacheFile, cacheTtl)
+	if configure != nil {
+		configure(api)
 	}
+
 	// set cachedb
-	api.Cache = api.InitDb()
+	db, err := api.openDb()
+	if err != nil {
+		return nil, err
+	}
+	api.Cache = cacheDb{bunt: db, api: api}
 
 	// get api limits info from cache
 	api.GetFromCache()
 
+	return api, nil
+}
+
+// create new apiClientSettings with defaults, without cache
+func newApiClientSettings(apiBearerToken string, cacheFile string, cacheTtl time.Duration) *ApiClientSettings {
+	return &ApiClientSettings{
+		ApiEndpoint:         DefaultEndpoint,
+		ApiBearerToken:      apiBearerToken,
+		UserAgent:           defaultUserAgent,
+		CacheTtl:            cacheTtl,
+		CacheFile:           cacheFile,
+		MaxCacheTtl:         defaultMaxCacheTtl,
+		MaxIdleConns:        defaultMaxIdleConns,
+		MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     defaultIdleConnTimeout,
+	}
+}
+
+// create new apiClientSettings with a cache that is opened on first use instead of in the constructor
+// so no db file is created for a client that is never used, open errors are returned by the first lookup
+func NewApiClientSettingsLazy(apiBearerToken string, cacheFile string, cacheTtl time.Duration) *ApiClientSettings {
+	api := newApiClientSettings(apiBearerToken, cacheFile, cacheTtl)
+	api.Cache = cacheDb{api: api, lazy: &lazyDb{open: func() (*buntdb.DB, error) {
+		db, err := api.openDb()
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		// get api limits info from cache
+		db.View(api.readApiInfo)
+		return db, nil
+	}}}
 	return api
+}
+
+// env var to read the bearer token from (see NewApiClientSettingsFromEnv)
+const TokenEnvVar = "POSTCODE_API_TOKEN"
 
+// create new apiClientSettings with cache, reading the bearer token from POSTCODE_API_TOKEN
+func NewApiClientSettingsFromEnv(cacheFile string, cacheTtl time.Duration) (*ApiClientSettings, error) {
+	apiBearerToken := os.Getenv(TokenEnvVar)
+	if apiBearerToken == "" {
+		return nil, ErrMissingToken
+	}
+	return OpenApiClientSettings(apiBearerToken, cacheFile, cacheTtl, nil)
 }
 
 // function to fetch from api
 func (api *ApiClientSettings) FetchFromApi(postcode string, number string) *ApiFullResponse {
+	apiResponse, _ := api.fetchFromApi(api.baseContext(), postcode, number)
+	// 404 = postcode / number combination not found
+	// save to cache, so we don't have to fetch from api again
+	if apiResponse != nil && apiResponse.Outcome == OutcomeNotFound {
+		api.saveCached(postcode, number, apiResponse)
+	}
+	return apiResponse
+}
+
+// function to fetch from api, the request is cancelled when ctx is done
+// api errors (e.g. 404) are returned as a response with Error and Outcome set,
+// the error is only set when there is no usable api response
+func (api *ApiClientSettings) fetchFromApi(ctx context.Context, postcode string, number string) (*ApiFullResponse, error) {
+	// an empty postcode or number would waste a request on a malformed url
+	if err := checkNotEmpty(postcode, number); err != nil {
+		return nil, err
+	}
+	if api.lifecycle.isClosed() {
+		return nil, ErrClosed
+	}
+	// never spend api budget in read-only mode
+	if api.ReadOnlyCache {
+		return nil, ErrNotCached
+	}
+	// only log the request in dry run mode
+	if api.DryRun {
+		log.Println("dry run, not fetching:", api.redactURL(api.lookupURL(postcode, number)))
+		return nil, ErrDryRunMiss
+	}
+
 	// fetch from api
 	// prepare request
-	req, err := http.NewRequest("GET", api.ApiEndpoint+"postcode/full?postcode="+postcode+"&number="+number, nil)
+	req, err := api.newRequest(ctx, postcode, number)
 	if err != nil {
-		log.Println(err)
-		return nil
+		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+api.ApiBearerToken)
-	req.Header.Set("User-Agent", "sw-core/2.0")
 
-	// send request
-	resp, err := http.DefaultClient.Do(req)
+	// send request, retrying failed attempts
+	resp, err := api.doWithRetry(ctx, req)
 	if err != nil {
-		log.Println(err)
-		return nil
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// update rate limit info
-	api.ApiInfo.MaxRequestsPerMinute, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
-	api.ApiInfo.RemainingRequests, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
-	api.ApiInfo.MaxRequestsPerDay, _ = strconv.Atoi(resp.Header.Get("X-API-Limit"))
-	api.ApiInfo.RemainingRequestsToday, _ = strconv.Atoi(resp.Header.Get("X-API-Remaining"))
+	info := api.RateLimitHeaderMap.Parse(resp.Header)
+	fetchedAt := time.Now()
+	api.setApiLimits(info, fetchedAt)
+	limits := info.withTime(fetchedAt)
 
 	// save api info to cache
 	api.SaveToCache()
@@ -117,95 +464,355 @@ func (api *ApiClientSettings) FetchFromApi(postcode string, number string) *ApiF
 	if resp.StatusCode != 200 {
 		// check if 404
 		if resp.StatusCode == 404 {
-
-			// save to cache, so we don't have to fetch from api again
-			api.Cache.SaveToCache(postcode+number, cache{ApiFullResponse{Error: "unknown combination"}, time.Now()})
-			return &ApiFullResponse{Error: "unknown combination"}
+			return &ApiFullResponse{Error: notFoundMessage, Outcome: OutcomeNotFound, ApiInfo: limits, FetchedAt: fetchedAt}, nil
 		}
+		api.countStat(func(s *Stats) { s.ApiErrors++ })
 		// if 429 (too many requests) return error (so we don't cache this)
 		if resp.StatusCode == 429 {
-			return &ApiFullResponse{Error: "too many requests"}
+			return &ApiFullResponse{Error: rateLimitedMessage, Outcome: OutcomeRateLimited, ApiInfo: limits, FetchedAt: fetchedAt}, nil
+		}
+		// if 401 (token rejected) return error
+		if resp.StatusCode == 401 {
+			return &ApiFullResponse{Error: "api error", Outcome: OutcomeUnauthorized, ApiInfo: limits, FetchedAt: fetchedAt}, nil
 		}
 		// return api error
-		return &ApiFullResponse{Error: "api error"}
+		return &ApiFullResponse{Error: "api error", Outcome: OutcomeUpstreamError, ApiInfo: limits, FetchedAt: fetchedAt}, nil
 	}
 
 	// read response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Println(err)
-		return nil
+		api.countStat(func(s *Stats) { s.ApiErrors++ })
+		return nil, fmt.Errorf("%w: %w", ErrLookupFailed, err)
 	}
 
 	// convert json to struct
-	var apiResponse ApiFullResponse
-	err = json.Unmarshal(body, &apiResponse)
+	apiResponse, err := decodeApiResponse(body)
 	if err != nil {
 		log.Println(err)
-		return nil
+		api.countStat(func(s *Stats) { s.ApiErrors++ })
+		return nil, newDecodeError(err, body)
+	}
+	// check the response against the expected contract
+	if api.StrictDecode {
+		if err := apiResponse.validate(); err != nil {
+			log.Println(err)
+			api.countStat(func(s *Stats) { s.ApiErrors++ })
+			return nil, newDecodeError(err, body)
+		}
+	}
+	apiResponse.Outcome = OutcomeOK
+	apiResponse.FetchedAt = fetchedAt
+	apiResponse.ApiInfo = limits
+	apiResponse.raw = body
+	for i := range apiResponse.Alternatives {
+		apiResponse.Alternatives[i].Outcome = OutcomeOK
+	}
+	if api.Transform != nil {
+		api.Transform(&apiResponse)
+		for i := range apiResponse.Alternatives {
+			api.Transform(&apiResponse.Alternatives[i])
+		}
+	}
+	return &apiResponse, nil
+}
+
+// function to get the context for methods without a ctx argument
+func (api *ApiClientSettings) baseContext() context.Context {
+	if api.BaseContext != nil {
+		return api.BaseContext
+	}
+	return context.Background()
+}
+
+// function to get the cache ttl, capped at MaxCacheTtl
+func (api *ApiClientSettings) cacheTtl() time.Duration {
+	if api.MaxCacheTtl > 0 && api.CacheTtl > api.MaxCacheTtl {
+		api.ttlWarning.Do(func() {
+			log.Printf("CacheTtl %v exceeds MaxCacheTtl %v, using %v", api.CacheTtl, api.MaxCacheTtl, api.MaxCacheTtl)
+		})
+		return api.MaxCacheTtl
 	}
-	return &apiResponse
+	return api.CacheTtl
 }
 
 // function to get from api or cache
+// not found (and other api errors) are returned as a response with Error and Outcome set,
+// nil is only returned for invalid input or when there is no api response at all (e.g. network error)
 func (api *ApiClientSettings) GetPostcodeInfo(postcode string, number string) *ApiFullResponse {
+	apiResponse, _ := api.GetPostcodeInfoContext(api.baseContext(), postcode, number)
+	return apiResponse
+}
+
+// function to get from api or cache, the api request is cancelled when ctx is done
+// not found returns the response with ErrNotFound, other api errors return the matching Err* error
+func (api *ApiClientSettings) GetPostcodeInfoContext(ctx context.Context, postcode string, number string) (*ApiFullResponse, error) {
+	apiResponse, _, err := api.getPostcodeInfo(ctx, postcode, number, true)
+	return apiResponse, err
+}
+
+// function to get from cache or api without storing a fetched result, e.g. for one-off lookups
+// same behavior as GetPostcodeInfoContext otherwise
+func (api *ApiClientSettings) GetPostcodeInfoNoStore(ctx context.Context, postcode string, number string) (*ApiFullResponse, error) {
+	apiResponse, _, err := api.getPostcodeInfo(ctx, postcode, number, false)
+	return apiResponse, err
+}
+
+// function to get from cache or api, including the age of the response and whether it was served from cache
+// e.g. to set Age / Cache-Control headers downstream, same behavior as GetPostcodeInfoContext otherwise
+func (api *ApiClientSettings) GetPostcodeInfoMeta(ctx context.Context, postcode string, number string) (*ApiFullResponse, time.Duration, bool, error) {
+	apiResponse, meta, err := api.getPostcodeInfo(ctx, postcode, number, true)
+	if !meta.fromCache {
+		return apiResponse, 0, false, err
+	}
+	return apiResponse, time.Since(meta.cachedAt), true, err
+}
+
+// function to get the api response body from cache or api, e.g. for passthrough proxies
+// the exact body is only available for cached entries with StoreRawResponse (otherwise the response is re-encoded)
+func (api *ApiClientSettings) GetPostcodeInfoRaw(ctx context.Context, postcode string, number string) ([]byte, error) {
+	apiResponse, _, err := api.getPostcodeInfo(ctx, postcode, number, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(apiResponse.raw) > 0 {
+		return apiResponse.raw, nil
+	}
+	return json.Marshal(apiResponse)
+}
+
+// struct for details of how a lookup was served
+type lookupMeta struct {
+	fromCache bool
+	cachedAt  time.Time
+	noGeo     bool // cached api response had no geo
+}
+
+// function to get from cache or api, fetched results are only saved to cache when store is set
+// traced as SpanLookup when a Tracer is set
+func (api *ApiClientSettings) getPostcodeInfo(ctx context.Context, postcode string, number string, store bool) (*ApiFullResponse, lookupMeta, error) {
+	postcode = normalizePostcode(postcode)
+	ctx, end := api.startSpan(ctx, SpanLookup)
+	apiResponse, meta, err := api.lookup(ctx, postcode, number, store)
+	end(map[string]any{"postcode": postcode, "cache_hit": meta.fromCache}, err)
+	if !errors.Is(err, ErrInvalidInput) {
+		api.recordHotKey(postcode, number)
+	}
+	if api.PrefetchNeighbors && store && err == nil {
+		api.prefetchNeighbors(postcode, number)
+	}
+	return apiResponse, meta, err
+}
+
+// function to get from cache or api, see getPostcodeInfo
+func (api *ApiClientSettings) lookup(ctx context.Context, postcode string, number string, store bool) (*ApiFullResponse, lookupMeta, error) {
+	// validate input
+	if err := ValidatePostcode(postcode); err != nil {
+		return nil, lookupMeta{}, err
+	}
+	if err := api.ValidateHouseNumber(number); err != nil {
+		return nil, lookupMeta{}, err
+	}
+	// a closed db reads as a miss, so check Close first
+	if api.lifecycle.isClosed() {
+		return nil, lookupMeta{}, ErrClosed
+	}
+
+	// open lazy cache db, so open errors are returned
+	if _, err := api.Cache.db(); err != nil {
+		return nil, lookupMeta{}, err
+	}
+
 	// check cache
-	cached := api.Cache.GetFromCache(postcode + number)
+	cached, err := api.getCached(postcode, number)
+	if err != nil {
+		return nil, lookupMeta{}, err
+	}
 	// if cache is not empty and not expired
-	if cached != nil && time.Since(cached.CachedAt) < api.CacheTtl {
+	if cached != nil && time.Since(cached.CachedAt) < api.entryTtl(cached) {
 		// return from cache
 
+		// fill outcome for entries cached before Outcome existed
+		cached.ApiFullResponse.Outcome = cached.ApiFullResponse.outcome()
+		cached.ApiFullResponse.raw = cached.Raw
+		api.fillApiInfo(&cached.ApiFullResponse)
+
 		// check if cached api response is valid (e.g. not 404)
-		if cached.ApiFullResponse.Error == "" {
-			return &cached.ApiFullResponse
+		if cached.ApiFullResponse.Outcome == OutcomeOK {
+			api.countStat(func(s *Stats) { s.CacheHits++ })
+			if api.Transform != nil && api.TransformOnCacheHit {
+				api.Transform(&cached.ApiFullResponse)
+			}
+			return &cached.ApiFullResponse, lookupMeta{fromCache: true, cachedAt: cached.CachedAt, noGeo: cached.NoGeo}, nil
 		} else {
 			// check ttl of cache
-			if time.Since(cached.CachedAt) < api.CacheTtl/6 {
+			if time.Since(cached.CachedAt) < api.errorTtl(cached) {
 				// // log for debugging
 				// log.Println("cache hit (error)")
 				// // serving this error from cache, because it's not expired for x more days
 				// log.Printf("Serving this error from cache, because it's not expired for %v more days", api.cacheTtl/6/24/60/60)
 
 				// if cache is not expired, return cached error
-				return &cached.ApiFullResponse
+				api.countStat(func(s *Stats) { s.CacheHits++ })
+				return &cached.ApiFullResponse, lookupMeta{fromCache: true, cachedAt: cached.CachedAt}, cached.ApiFullResponse.Outcome.err()
 			}
 		}
 	}
-	// fetch from api
-	apiResponse := api.FetchFromApi(postcode, number)
-	// save to cache, if valid response
-	if apiResponse != nil {
-		api.Cache.SaveToCache(postcode+number, cache{*apiResponse, time.Now()})
-		return apiResponse
+	api.countStat(func(s *Stats) { s.CacheMisses++ })
+	if api.ReadOnlyCache {
+		return nil, lookupMeta{}, ErrNotCached
 	}
-	return nil
+
+	// don't waste a request when the last known rate limits are exhausted
+	if api.FailFastWhenRateLimited && api.NextAllowedAt().After(time.Now()) {
+		return api.staleOnError(cached, &ApiFullResponse{Error: rateLimitedMessage, Outcome: OutcomeRateLimited}, ErrRateLimited)
+	}
+
+	apiResponse, err := api.fetchShared(ctx, postcode, number, store)
+	if ctx.Err() != nil {
+		return apiResponse, lookupMeta{}, err
+	}
+	return api.staleOnError(cached, apiResponse, err)
+}
+
+// function to fetch from api, concurrent lookups of the same combination share one request
+// found and not found responses are saved to cache when store is set
+func (api *ApiClientSettings) fetchShared(ctx context.Context, postcode string, number string, store bool) (*ApiFullResponse, error) {
+	flightKey := normalizePostcode(postcode) + number
+	if !store {
+		flightKey += "|nostore"
+	}
+	base := flightContext{Context: api.baseContext(), values: ctx}
+	return api.inflight.do(ctx, base, flightKey, func(ctx context.Context) (*ApiFullResponse, error) {
+		apiResponse, err := api.fetchFromApi(ctx, postcode, number)
+		// save to cache, if valid response
+		if apiResponse != nil {
+			// only found and not found are cached, other errors (e.g. 429) are temporary
+			if store && (apiResponse.Outcome == OutcomeOK || apiResponse.Outcome == OutcomeNotFound) {
+				api.saveCached(postcode, number, apiResponse)
+			}
+			return apiResponse, apiResponse.Outcome.err()
+		}
+		// request cancelled or timed out
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	})
+}
+
+// function to get postcode info and the api limits info of the same api request
+// avoids reading older numbers with a separate GetApiLimitInfoJson call after the lookup
+// when the lookup is served from cache (no api request), the last known api limits info is returned
+func (api *ApiClientSettings) GetPostcodeInfoWithBudget(ctx context.Context, postcode string, number string) (*ApiFullResponse, ApiLimitInfoJson, error) {
+	apiResponse, meta, err := api.getPostcodeInfo(ctx, postcode, number, true)
+	if apiResponse != nil && !meta.fromCache && !apiResponse.ApiInfo.CachingTime.IsZero() {
+		return apiResponse, apiResponse.ApiInfo, err
+	}
+	return apiResponse, api.ApiLimits().withTime(api.GetCachingTime()), err
+}
+
+// function to get the coordinates of an address
+// a cached entry without geo (e.g. cached before geo was stored) is re-fetched instead of served incomplete
+// when the api response had no geo either, ErrNoGeo is returned without re-fetching until the entry expires
+// geo is kept in cache entries from the first call on, also when StoreFields leaves it out
+func (api *ApiClientSettings) GetCoordinates(ctx context.Context, postcode string, number string) (Geo, error) {
+	api.keepGeo.Store(true)
+	apiResponse, meta, err := api.getPostcodeInfo(ctx, postcode, number, true)
+	if err != nil {
+		return Geo{}, err
+	}
+	if apiResponse.Geo.IsZero() && meta.fromCache && !meta.noGeo && !api.ReadOnlyCache {
+		apiResponse, err = api.fetchShared(ctx, postcode, number, true)
+		if err != nil {
+			return Geo{}, err
+		}
+	}
+	if apiResponse.Geo.IsZero() {
+		return Geo{}, ErrNoGeo
+	}
+	return apiResponse.Geo, nil
+}
+
+// function to serve an expired cache entry when the api request failed (not for 404), with ServeStaleOnError
+func (api *ApiClientSettings) staleOnError(cached *cache, apiResponse *ApiFullResponse, err error) (*ApiFullResponse, lookupMeta, error) {
+	if err == nil || errors.Is(err, ErrNotFound) || !api.ServeStaleOnError || cached == nil {
+		return apiResponse, lookupMeta{}, err
+	}
+	log.Println("serving stale cache entry:", err)
+	api.countStat(func(s *Stats) { s.StaleHits++ })
+	cached.ApiFullResponse.Stale = true
+	api.fillApiInfo(&cached.ApiFullResponse)
+	return &cached.ApiFullResponse, lookupMeta{fromCache: true, cachedAt: cached.CachedAt}, cached.ApiFullResponse.outcome().err()
 }
 
-// function to get postcode and number from string (e.g. 6931XE130 or 6931XE 130)
+// function to get all matches of a postcode / number combination, the first is the one GetPostcodeInfoContext returns
+// usually there is one match, but the api can return several addresses for a number (e.g. split buildings)
+func (api *ApiClientSettings) GetPostcodeInfoAll(ctx context.Context, postcode string, number string) ([]*ApiFullResponse, error) {
+	apiResponse, err := api.GetPostcodeInfoContext(ctx, postcode, number)
+	if err != nil {
+		return nil, err
+	}
+	matches := []*ApiFullResponse{apiResponse}
+	for i := range apiResponse.Alternatives {
+		matches = append(matches, &apiResponse.Alternatives[i])
+	}
+	return matches, nil
+}
+
+// function to get postcode and number from string (e.g. 6931XE130 or 6931XE 130, see ParsePostcodeString)
+// same behavior as GetPostcodeInfo, nil for a string without postcode and number
 func (api *ApiClientSettings) GetPostcodeInfoFromString(postcodeNumber string) *ApiFullResponse {
-	// use regex to get postcode and number
-	re := regexp.MustCompile(`([0-9]{4}[A-Z]{2})([0-9]+)`)
-	matches := re.FindStringSubmatch(postcodeNumber)
-	if len(matches) == 3 {
-		return api.GetPostcodeInfo(matches[1], matches[2])
+	apiResponse, _ := api.GetPostcodeInfoFromStringContext(api.baseContext(), postcodeNumber)
+	return apiResponse
+}
+
+// function to get postcode and number from string, same behavior as GetPostcodeInfoContext
+// a string without postcode and number returns the ErrInvalidInput of ParsePostcodeString
+func (api *ApiClientSettings) GetPostcodeInfoFromStringContext(ctx context.Context, postcodeNumber string) (*ApiFullResponse, error) {
+	pair, err := ParsePostcodeString(postcodeNumber)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return api.GetPostcodeInfoContext(ctx, pair.Postcode, pair.Number)
 }
 
 // function to get short info from api (PIS = Postcode Info Short)
+// the api has no short endpoint, so a cache miss costs a full request (counted in Stats.ShortApiRequests)
+// the full response is cached, so a later GetPostcodeInfo for the same address is free
+// with ShortLookupCacheOnly a cache miss returns nil without an api request
 func (api *ApiClientSettings) GetPIS(postcode string, number string) *ApiShortResponse {
+	// validate input
+	if err := ValidatePostcode(postcode); err != nil {
+		log.Println(err)
+		return nil
+	}
+	if err := api.ValidateHouseNumber(number); err != nil {
+		log.Println(err)
+		return nil
+	}
+	postcode = normalizePostcode(postcode)
+
 	// check cache
-	cached := api.Cache.GetFromCache(postcode + number)
+	cached, err := api.getCached(postcode, number)
+	if err != nil {
+		return nil
+	}
 	// if cache is not empty and not expired
-	if cached != nil && time.Since(cached.CachedAt) < api.CacheTtl {
+	if cached != nil && time.Since(cached.CachedAt) < api.entryTtl(cached) {
 		// return from cache
+		api.countStat(func(s *Stats) { s.CacheHits++ })
 		return &ApiShortResponse{cached.ApiFullResponse.Street, cached.ApiFullResponse.City}
 	}
-	// fetch from api
-	apiResponse := api.FetchFromApi(postcode, number)
-	// save to cache, if valid response
+	api.countStat(func(s *Stats) { s.CacheMisses++ })
+	if api.ShortLookupCacheOnly {
+		return nil
+	}
+	// fetch from api (full request), only found and not found responses are cached
+	api.countStat(func(s *Stats) { s.ShortApiRequests++ })
+	apiResponse, _ := api.fetchShared(api.baseContext(), postcode, number, true)
 	if apiResponse != nil {
-		api.Cache.SaveToCache(postcode+number, cache{*apiResponse, time.Now()})
 		return &ApiShortResponse{apiResponse.Street, apiResponse.City}
 	}
 	return nil
@@ -215,12 +822,14 @@ func (api *ApiClientSettings) GetPIS(postcode string, number string) *ApiShortRe
 func (api *ApiClientSettings) GetApiLimitInfoJson() string {
 
 	// check if api limit info is available
-	if api.ApiInfo.MaxRequestsPerMinute == 0 {
+	info := api.ApiLimits()
+	if info.MaxRequestsPerMinute == 0 {
 		// try loading api limit info from cache
 		api.GetFromCache()
+		info = api.ApiLimits()
 
 		// check if api limit info is still not available
-		if api.ApiInfo.MaxRequestsPerMinute == 0 {
+		if info.MaxRequestsPerMinute == 0 {
 			log.Println("API limit info not available")
 			return "n/a"
 		} else {
@@ -239,10 +848,10 @@ func (api *ApiClientSettings) GetApiLimitInfoJson() string {
 
 	// create api limit info struct
 	apiLimitsInfo := ApiLimitInfoJson{
-		MaxRequestsPerMinute:   api.ApiInfo.MaxRequestsPerMinute,
-		RemainingRequests:      api.ApiInfo.RemainingRequests,
-		MaxRequestsPerDay:      api.ApiInfo.MaxRequestsPerDay,
-		RemainingRequestsToday: api.ApiInfo.RemainingRequestsToday,
+		MaxRequestsPerMinute:   info.MaxRequestsPerMinute,
+		RemainingRequests:      info.RemainingRequests,
+		MaxRequestsPerDay:      info.MaxRequestsPerDay,
+		RemainingRequestsToday: info.RemainingRequestsToday,
 		CachingTime:            api.GetCachingTime(),
 		TimeSinceLastCache:     time.Duration(time.Since(api.GetCachingTime()).Seconds()),
 	}
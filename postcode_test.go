@@ -0,0 +1,141 @@
+package postcodeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// address returned by the api stubs
+const testAddressJson = `{"postcode":"6931XE","number":130,"street":"Dorpsstraat","city":"Westervoort","municipality":"Westervoort","province":"Gelderland","geo":{"lat":51.96,"lon":5.97}}`
+
+// function to get a client for an api stub, hits counts the requests that reached the stub
+func newTestApi(t testing.TB, handler http.HandlerFunc) (api *ApiClientSettings, hits *atomic.Int32) {
+	hits = new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	api = NewApiClientSettings("token", t.TempDir()+"/cache.db", time.Hour)
+	t.Cleanup(func() { api.Close() })
+	api.ApiEndpoint = srv.URL + "/"
+	return api, hits
+}
+
+func TestSharedClientAcrossHandlers(t *testing.T) {
+	api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		// slow enough for concurrent lookups of an address to overlap
+		time.Sleep(10 * time.Millisecond)
+		number := r.URL.Query().Get("number")
+		fmt.Fprintf(w, `{"postcode":"6931XE","number":%s,"street":"Dorpsstraat","city":"Westervoort"}`, number)
+	})
+
+	// one client shared by all requests of a server, as in cmd/pcapi-server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postcode, number, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		info, err := api.GetPostcodeInfoContext(r.Context(), postcode, number)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	}))
+	defer srv.Close()
+
+	const numbers, requestsPerNumber = 5, 20
+	var wg sync.WaitGroup
+	for i := 0; i < numbers*requestsPerNumber; i++ {
+		number := i%numbers + 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(fmt.Sprintf("%s/6931XE/%d", srv.URL, number))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			var info ApiFullResponse
+			if err := json.NewDecoder(resp.Body).Decode(&info); err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("status %d, decode error %v", resp.StatusCode, err)
+				return
+			}
+			if info.Number != number || info.Street != "Dorpsstraat" {
+				t.Errorf("got number %d street %q, want number %d", info.Number, info.Street, number)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// concurrent lookups of an address share one api request, later ones are served from cache
+	if n := hits.Load(); n != numbers {
+		t.Errorf("%d api requests, want %d", n, numbers)
+	}
+	if stats := api.Stats(); stats.CacheHits+stats.CacheMisses != numbers*requestsPerNumber {
+		t.Errorf("stats count %d lookups, want %d", stats.CacheHits+stats.CacheMisses, numbers*requestsPerNumber)
+	}
+}
+
+func TestLookupAfterClose(t *testing.T) {
+	api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAddressJson))
+	})
+	ctx := context.Background()
+	if _, err := api.GetPostcodeInfoContext(ctx, "6931XE", "130"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		number string
+	}{
+		{"cached", "130"},
+		{"not cached", "131"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := api.GetPostcodeInfoContext(ctx, "6931XE", tt.number); !errors.Is(err, ErrClosed) {
+				t.Errorf("GetPostcodeInfoContext error = %v, want ErrClosed", err)
+			}
+			if _, err := api.fetchFromApi(ctx, "6931XE", tt.number); !errors.Is(err, ErrClosed) {
+				t.Errorf("fetchFromApi error = %v, want ErrClosed", err)
+			}
+		})
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("%d api requests, want 1", n)
+	}
+}
+
+func BenchmarkGetPostcodeInfoCached(b *testing.B) {
+	api, _ := newTestApi(b, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAddressJson))
+	})
+	ctx := context.Background()
+	if _, err := api.GetPostcodeInfoContext(ctx, "6931XE", "130"); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := api.GetPostcodeInfoContext(ctx, "6931XE", "130"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
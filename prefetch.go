@@ -0,0 +1,111 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// default number of numbers below and above the looked up number to prefetch
+const defaultNeighborRange = 5
+
+// function to get the number of neighbors to prefetch on each side
+func (api *ApiClientSettings) neighborRange() int {
+	if api.NeighborRange <= 0 {
+		return defaultNeighborRange
+	}
+	return api.NeighborRange
+}
+
+// struct for the neighbors that are being prefetched, so they are queued only once
+type prefetchSet struct {
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// function to mark a key as pending, returns false if it already is
+func (s *prefetchSet) add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[string]bool)
+	}
+	if s.pending[key] {
+		return false
+	}
+	s.pending[key] = true
+	return true
+}
+
+// function to unmark a pending key
+func (s *prefetchSet) remove(key string) {
+	s.mu.Lock()
+	delete(s.pending, key)
+	s.mu.Unlock()
+}
+
+// function to prefetch the neighbors of a found number in the background (see PrefetchNeighbors)
+// nearest neighbors go first, fresh cached and already queued numbers are skipped
+// requests wait for the throttle, prefetching stops when the api limits are reached or at Shutdown
+func (api *ApiClientSettings) prefetchNeighbors(postcode string, number string) {
+	if api.ReadOnlyCache || api.DryRun {
+		return
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return
+	}
+
+	stopped := api.lifecycle.stopped()
+	api.goBackground(func() {
+		// neighbors that are not cached yet, in order n+1, n-1, n+2, n-2, ...
+		// scanned here, so the lookup doesn't wait for the cache reads
+		var neighbors []string
+		for offset := 1; offset <= api.neighborRange(); offset++ {
+			for _, neighbor := range []int{n + offset, n - offset} {
+				candidate := strconv.Itoa(neighbor)
+				if neighbor < 1 || api.ValidateHouseNumber(candidate) != nil {
+					continue
+				}
+				if cached, _ := api.getCached(postcode, candidate); api.isFresh(cached) {
+					continue
+				}
+				if api.prefetching.add(postcode + candidate) {
+					neighbors = append(neighbors, candidate)
+				}
+			}
+		}
+		if len(neighbors) == 0 {
+			return
+		}
+		defer func() {
+			for _, neighbor := range neighbors {
+				api.prefetching.remove(postcode + neighbor)
+			}
+		}()
+
+		// stop waiting for the throttle at Shutdown
+		ctx, cancel := context.WithCancel(api.baseContext())
+		defer cancel()
+		go func() {
+			select {
+			case <-stopped:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		for _, neighbor := range neighbors {
+			if ctx.Err() != nil || api.NextAllowedAt().After(time.Now()) {
+				return
+			}
+			// lookup instead of getPostcodeInfo, so prefetched numbers don't prefetch their own neighbors
+			_, _, err := api.lookup(ctx, postcode, neighbor, true)
+			if errors.Is(err, ErrRateLimited) {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package postcodeapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPrefetchNeighbors(t *testing.T) {
+	api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAddressJson))
+	})
+	api.PrefetchNeighbors = true
+	api.NeighborRange = 1
+	ctx := context.Background()
+	if _, err := api.GetPostcodeInfoContext(ctx, "6931XE", "5"); err != nil {
+		t.Fatal(err)
+	}
+	// 4 and 6 are prefetched in the background
+	prefetched := func() bool {
+		for _, number := range []string{"4", "6"} {
+			if cached, _ := api.getCached("6931XE", number); !api.isFresh(cached) {
+				return false
+			}
+		}
+		return true
+	}
+	for deadline := time.Now().Add(5 * time.Second); !prefetched(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("neighbors not prefetched")
+		}
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("%d api requests, want 3", n)
+	}
+}
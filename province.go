@@ -0,0 +1,30 @@
+package postcodeapi
+
+import "strings"
+
+// province abbreviations (ISO 3166-2:NL codes without the NL- prefix)
+var provinceAbbreviations = map[string]string{
+	"drenthe":       "DR",
+	"flevoland":     "FL",
+	"friesland":     "FR",
+	"fryslân":       "FR",
+	"gelderland":    "GE",
+	"groningen":     "GR",
+	"limburg":       "LI",
+	"noord-brabant": "NB",
+	"noord-holland": "NH",
+	"overijssel":    "OV",
+	"utrecht":       "UT",
+	"zeeland":       "ZE",
+	"zuid-holland":  "ZH",
+}
+
+// function to get the abbreviation of a province (e.g. Gelderland = GE), empty if unknown
+func ProvinceAbbreviation(province string) string {
+	return provinceAbbreviations[strings.ToLower(strings.TrimSpace(province))]
+}
+
+// function to get the abbreviation of the province of the response
+func (r *ApiFullResponse) ProvinceAbbreviation() string {
+	return ProvinceAbbreviation(r.Province)
+}
@@ -0,0 +1,226 @@
+package postcodeapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rate limit headers of api responses
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"     // max requests per minute
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining" // remaining requests this minute
+	HeaderApiLimit           = "X-API-Limit"           // max requests per day
+	HeaderApiRemaining       = "X-API-Remaining"       // remaining requests today
+)
+
+// struct for the names of the rate limit headers, for compatible apis using other names
+// empty names use the postcode.tech headers
+type RateLimitHeaderMap struct {
+	MaxRequestsPerMinute   string
+	RemainingRequests      string
+	MaxRequestsPerDay      string
+	RemainingRequestsToday string
+}
+
+// rate limit header names of postcode.tech
+var DefaultRateLimitHeaderMap = RateLimitHeaderMap{
+	MaxRequestsPerMinute:   HeaderRateLimitLimit,
+	RemainingRequests:      HeaderRateLimitRemaining,
+	MaxRequestsPerDay:      HeaderApiLimit,
+	RemainingRequestsToday: HeaderApiRemaining,
+}
+
+// function to get the api limits info from the rate limit headers of an api response
+// missing or invalid headers are 0
+func ParseRateLimitHeaders(h http.Header) ApiLimitsInfo {
+	return DefaultRateLimitHeaderMap.Parse(h)
+}
+
+// function to get the api limits info from the headers named in the map
+// missing or invalid headers are 0
+func (m RateLimitHeaderMap) Parse(h http.Header) ApiLimitsInfo {
+	header := func(name string, fallback string) int {
+		if name == "" {
+			name = fallback
+		}
+		value, _ := strconv.Atoi(h.Get(name))
+		return value
+	}
+	return ApiLimitsInfo{
+		MaxRequestsPerMinute:   header(m.MaxRequestsPerMinute, HeaderRateLimitLimit),
+		RemainingRequests:      header(m.RemainingRequests, HeaderRateLimitRemaining),
+		MaxRequestsPerDay:      header(m.MaxRequestsPerDay, HeaderApiLimit),
+		RemainingRequestsToday: header(m.RemainingRequestsToday, HeaderApiRemaining),
+	}
+}
+
+// function to get the time at which the next api request can be made without hitting the rate limits
+// based on the last known api limits info, returns the current time when unknown or not limited
+func (api *ApiClientSettings) NextAllowedAt() time.Time {
+	now := time.Now()
+	info, infoAt := api.limitsAt()
+	// no api limits info known yet
+	if info.MaxRequestsPerMinute == 0 && info.MaxRequestsPerDay == 0 {
+		return now
+	}
+
+	// daily limit reached, wait for the day after the info was received
+	// (stale info of an earlier day has been reset already)
+	if info.MaxRequestsPerDay > 0 && info.RemainingRequestsToday <= 0 {
+		year, month, day := infoAt.In(now.Location()).Date()
+		resetAt := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+		if resetAt.After(now) {
+			return resetAt
+		}
+		return now
+	}
+
+	// per minute limit reached, wait until a minute after the last api response
+	if info.MaxRequestsPerMinute > 0 && info.RemainingRequests <= 0 {
+		resetAt := infoAt.Add(time.Minute)
+		if resetAt.After(now) {
+			return resetAt
+		}
+	}
+	return now
+}
+
+// function to get the delay until the next api request can be made without hitting the rate limits
+func (api *ApiClientSettings) SuggestedDelay() time.Duration {
+	delay := time.Until(api.NextAllowedAt())
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// struct for client side throttling, spreads api requests evenly over a minute
+type limiter struct {
+	mu   sync.Mutex
+	next time.Time // time the next request is allowed
+}
+
+// function to wait until a request is allowed at perMinute requests per minute
+// returns ctx.Err() without waiting any longer when ctx is done
+func (l *limiter) Wait(ctx context.Context, perMinute int) error {
+	if perMinute <= 0 {
+		return nil
+	}
+	interval := time.Minute / time.Duration(perMinute)
+
+	// reserve a slot
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(interval)
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// function to reserve n requests of the remaining daily budget, e.g. per tenant sharing one token
+// succeeds only if RemainingRequestsToday minus the reserved requests is at least n
+// reservations are in-process accounting only (requests are not blocked), give them back with Release
+// when no daily limit is known yet, reservations always succeed
+func (api *ApiClientSettings) Reserve(n int) bool {
+	api.apiInfoMu.Lock()
+	defer api.apiInfoMu.Unlock()
+	if n <= 0 {
+		return true
+	}
+	limits := api.shared()
+	limits.reservedMu.Lock()
+	defer limits.reservedMu.Unlock()
+	if api.ApiInfo.MaxRequestsPerDay > 0 && api.ApiInfo.RemainingRequestsToday-limits.reserved < n {
+		return false
+	}
+	limits.reserved += n
+	return true
+}
+
+// function to give back n reserved requests, e.g. when they are used or not needed anymore
+func (api *ApiClientSettings) Release(n int) {
+	limits := api.shared()
+	limits.reservedMu.Lock()
+	defer limits.reservedMu.Unlock()
+	limits.reserved -= n
+	if limits.reserved < 0 {
+		limits.reserved = 0
+	}
+}
+
+// number of in-memory snapshots of the daily budget, see BurnRate
+const budgetSnapshots = 64
+
+// struct for a snapshot of the remaining daily budget
+type budgetSnapshot struct {
+	at        time.Time
+	remaining int
+}
+
+// function to keep a snapshot of the remaining daily budget, api.apiInfoMu must be held
+func (api *ApiClientSettings) recordBudget(info ApiLimitsInfo, at time.Time) {
+	if info.MaxRequestsPerDay <= 0 {
+		return
+	}
+	api.budget = append(api.budget, budgetSnapshot{at: at, remaining: info.RemainingRequestsToday})
+	if len(api.budget) > budgetSnapshots {
+		api.budget = api.budget[len(api.budget)-budgetSnapshots:]
+	}
+}
+
+// function to estimate the daily budget burn rate from today's snapshots of the remaining requests
+// uses the rate limit history when KeepRateLimitHistory is enabled (survives restarts), otherwise the in-memory snapshots
+// returns zero values when there are less than two snapshots today or no requests were used
+func (api *ApiClientSettings) BurnRate() (perHour float64, exhaustedAt time.Time) {
+	year, month, day := time.Now().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+
+	var snapshots []budgetSnapshot
+	if api.KeepRateLimitHistory {
+		history, _ := api.RateLimitHistory(today)
+		for _, info := range history {
+			if info.MaxRequestsPerDay > 0 {
+				snapshots = append(snapshots, budgetSnapshot{at: info.CachingTime, remaining: info.RemainingRequestsToday})
+			}
+		}
+	} else {
+		api.apiInfoMu.RLock()
+		for _, snapshot := range api.budget {
+			if !snapshot.at.Before(today) {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+		api.apiInfoMu.RUnlock()
+	}
+	if len(snapshots) < 2 {
+		return 0, time.Time{}
+	}
+
+	first, last := snapshots[0], snapshots[len(snapshots)-1]
+	hours := last.at.Sub(first.at).Hours()
+	used := first.remaining - last.remaining
+	if hours <= 0 || used <= 0 {
+		return 0, time.Time{}
+	}
+	perHour = float64(used) / hours
+	exhaustedAt = last.at.Add(time.Duration(float64(last.remaining) / perHour * float64(time.Hour)))
+	return perHour, exhaustedAt
+}
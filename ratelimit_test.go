@@ -0,0 +1,101 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestNextAllowedAt(t *testing.T) {
+	now := time.Now()
+	year, month, day := now.Date()
+	midnight := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	exhausted := ApiLimitsInfo{MaxRequestsPerMinute: 60, RemainingRequests: 10, MaxRequestsPerDay: 1000, RemainingRequestsToday: 0}
+	minuteExhausted := ApiLimitsInfo{MaxRequestsPerMinute: 60, RemainingRequests: 0, MaxRequestsPerDay: 1000, RemainingRequestsToday: 500}
+
+	tests := []struct {
+		name   string
+		info   ApiLimitsInfo
+		infoAt time.Time
+		want   time.Time // zero for now
+	}{
+		{"unknown", ApiLimitsInfo{}, time.Time{}, time.Time{}},
+		{"not limited", ApiLimitsInfo{MaxRequestsPerMinute: 60, RemainingRequests: 10, MaxRequestsPerDay: 1000, RemainingRequestsToday: 500}, now, time.Time{}},
+		{"daily limit today", exhausted, now, midnight},
+		{"daily limit yesterday", exhausted, now.Add(-24 * time.Hour), time.Time{}},
+		{"daily limit 48h ago", exhausted, now.Add(-48 * time.Hour), time.Time{}},
+		{"daily limit without time", exhausted, time.Time{}, time.Time{}},
+		{"minute limit", minuteExhausted, now, now.Add(time.Minute)},
+		{"minute limit passed", minuteExhausted, now.Add(-2 * time.Minute), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &ApiClientSettings{DisableRateLimitPersistence: true}
+			api.setApiLimits(tt.info, tt.infoAt)
+			got := api.NextAllowedAt()
+			want := tt.want
+			if want.IsZero() {
+				// now, allowing for the time the test takes
+				if d := time.Since(got); d < 0 || d > time.Second {
+					t.Errorf("NextAllowedAt() = %v, want now", got)
+				}
+				return
+			}
+			if !got.Equal(want) {
+				t.Errorf("NextAllowedAt() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFailFastWithStaleLimits(t *testing.T) {
+	exhausted := ApiLimitsInfo{MaxRequestsPerMinute: 60, RemainingRequests: 10, MaxRequestsPerDay: 1000, RemainingRequestsToday: 0}
+	tests := []struct {
+		name     string
+		infoAt   time.Time
+		wantErr  error
+		wantHits int32
+	}{
+		{"exhausted today", time.Now(), ErrRateLimited, 0},
+		{"exhausted 48h ago", time.Now().Add(-48 * time.Hour), nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// limits info persisted by an earlier process
+			cacheFile := t.TempDir() + "/cache.db"
+			earlier := NewApiClientSettings("token", cacheFile, time.Hour)
+			earlier.setApiLimits(exhausted, tt.infoAt)
+			earlier.SaveToCache()
+			earlier.Cache.update(func(tx *buntdb.Tx) error {
+				_, _, err := tx.Set(apiInfoCachedAtKey, tt.infoAt.Format(time.RFC3339), nil)
+				return err
+			})
+			earlier.Close()
+
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				w.Write([]byte(testAddressJson))
+			}))
+			defer srv.Close()
+			api := NewApiClientSettings("token", cacheFile, time.Hour)
+			defer api.Close()
+			api.ApiEndpoint = srv.URL + "/"
+			api.FailFastWhenRateLimited = true
+
+			_, err := api.GetPostcodeInfoContext(context.Background(), "6931XE", "130")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if n := hits.Load(); n != tt.wantHits {
+				t.Errorf("%d api requests, want %d", n, tt.wantHits)
+			}
+		})
+	}
+}
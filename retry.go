@@ -0,0 +1,123 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// default delay before the first retry, doubled for every next retry
+const defaultRetryBackoff = 500 * time.Millisecond
+
+// function to decide if an api request is retried, used when RetryPredicate is nil
+// retries network errors and 5xx responses, not 404 / 401 / 429 or a redirect to another host
+func DefaultRetryPredicate(statusCode int, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrRedirected)
+	}
+	return statusCode >= 500
+}
+
+// function to send an api request, retrying up to MaxRetries times with exponential backoff
+// statusCode is 0 when err is set, every attempt waits for the throttle and counts as an api request
+func (api *ApiClientSettings) doWithRetry(ctx context.Context, req *http.Request) (*http.Response, error) {
+	retry := api.RetryPredicate
+	if retry == nil {
+		retry = DefaultRetryPredicate
+	}
+	backoff := api.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		// wait for client side throttling
+		if err := api.shared().throttle.Wait(ctx, api.RequestsPerMinute); err != nil {
+			return nil, err
+		}
+
+		// send request
+		api.countStat(func(s *Stats) { s.ApiRequests++ })
+		_, end := api.startSpan(ctx, SpanRequest)
+		start := time.Now()
+		resp, err := api.send(ctx, req)
+		api.latency.record(time.Since(start))
+		err = api.redactError(err)
+
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		end(map[string]any{"status": statusCode, "attempt": attempt + 1}, err)
+		final := attempt >= api.MaxRetries || ctx.Err() != nil || !retry(statusCode, err)
+		if !final && !api.shared().retryBudget.take(api.RetryBudget, api.RetryBudgetPerMinute) {
+			// retry budget is used up (e.g. during an outage), fail now instead of adding load
+			api.countStat(func(s *Stats) { s.RetriesDenied++ })
+			final = true
+		}
+		if final {
+			if err != nil {
+				log.Println(err)
+				api.countStat(func(s *Stats) { s.ApiErrors++ })
+				return nil, fmt.Errorf("%w: %w", ErrLookupFailed, err)
+			}
+			return resp, nil
+		}
+
+		// discard the failed attempt, draining the body so the connection can be reused
+		api.countStat(func(s *Stats) { s.ApiErrors++ })
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			log.Println(err)
+		}
+		timer := time.NewTimer(backoff << attempt)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w: %w", ErrLookupFailed, ctx.Err())
+		}
+	}
+}
+
+// struct for a token bucket limiting retries of all requests together (see RetryBudget)
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // time of the last refill, zero = bucket not used yet (full)
+}
+
+// function to take a token from a bucket of size capacity, refilled at perMinute tokens per minute (0 = capacity)
+// returns false when the bucket is empty, capacity 0 means no limit
+func (b *tokenBucket) take(capacity int, perMinute int) bool {
+	if capacity <= 0 {
+		return true
+	}
+	if perMinute <= 0 {
+		perMinute = capacity
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = float64(capacity)
+	} else {
+		b.tokens += now.Sub(b.last).Minutes() * float64(perMinute)
+		if b.tokens > float64(capacity) {
+			b.tokens = float64(capacity)
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,101 @@
+package postcodeapi
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// default number of decimals of reverse lookup cache keys (~10m)
+const defaultGeoCachePrecision = 4
+
+// function to get the number of decimals lat / lon are rounded to for reverse lookup cache keys
+func (api *ApiClientSettings) geoCachePrecision() int {
+	if api.GeoCachePrecision <= 0 {
+		return defaultGeoCachePrecision
+	}
+	return api.GeoCachePrecision
+}
+
+// function to find the cached address nearest to lat / lon (reverse lookup)
+// the api has no reverse lookup, so only cached addresses within one GeoCachePrecision cell are found (ErrNotCached otherwise)
+// coordinates are rounded to GeoCachePrecision decimals, so nearby coordinates share the result of the cache scan
+func (api *ApiClientSettings) GetByCoordinates(lat, lon float64) (*ApiFullResponse, error) {
+	precision := api.geoCachePrecision()
+	key := api.geoKey(lat, lon, precision)
+
+	// reverse lookup cache
+	if address, ok := api.Cache.Get(key); ok {
+		apiResponse, err := api.cachedAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		if apiResponse != nil {
+			api.countStat(func(s *Stats) { s.CacheHits++ })
+			return apiResponse, nil
+		}
+	}
+	api.countStat(func(s *Stats) { s.CacheMisses++ })
+
+	// scan the cached addresses for the nearest one
+	maxDistance := math.Pow(10, -float64(precision)) * metersPerDegree
+	var nearest string
+	prefix := api.addressKeyPrefix()
+	err := api.Cache.view(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", prefix, func(key, val string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			if strings.HasPrefix(key, api.postcodeKey("")) {
+				return true
+			}
+			var value cache
+			if api.serializer().Unmarshal([]byte(val), &value) != nil || !value.migrate() || value.outcome() != OutcomeOK || value.Geo.IsZero() {
+				return true
+			}
+			if distance := DistanceBetween(lat, lon, value.Geo.Lat, value.Geo.Lon); distance <= maxDistance {
+				maxDistance, nearest = distance, key
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if nearest == "" {
+		return nil, ErrNotCached
+	}
+	apiResponse, err := api.cachedAddress(nearest)
+	if err != nil || apiResponse == nil {
+		return nil, ErrNotCached
+	}
+	if !api.ReadOnlyCache {
+		api.Cache.update(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set(key, nearest, &buntdb.SetOptions{Expires: true, TTL: api.cacheTtl()})
+			return err
+		})
+	}
+	return apiResponse, nil
+}
+
+// function to get the valid response cached under an address key, merged with the postcode level entry if enabled
+// returns nil when the entry is missing or an error
+func (api *ApiClientSettings) cachedAddress(key string) (*ApiFullResponse, error) {
+	cached, err := api.getCachedKey(key)
+	if err != nil || cached == nil || cached.outcome() != OutcomeOK {
+		return nil, err
+	}
+	if api.PostcodeLevelCache {
+		merged, err := api.getCached(cached.Postcode, strconv.Itoa(cached.Number))
+		if err != nil {
+			return nil, err
+		}
+		if merged != nil {
+			cached = merged
+		}
+	}
+	api.fillApiInfo(&cached.ApiFullResponse)
+	return &cached.ApiFullResponse, nil
+}
@@ -0,0 +1,52 @@
+package postcodeapi
+
+import (
+	"net/url"
+	"strings"
+)
+
+// type for an api lookup type, used to find its path template (see Routes)
+type Route string
+
+const (
+	// full address lookup by postcode and house number (GetPostcodeInfo, GetPIS, ValidateToken)
+	// GetByCoordinates has no route, the api has no reverse lookup so it only searches the cache
+	RouteFull Route = "full"
+)
+
+// function to get the path template of a route, relative to ApiEndpoint
+// templates contain {name} placeholders, e.g. "postcode/full?postcode={postcode}&number={number}"
+func (api *ApiClientSettings) routeTemplate(route Route) string {
+	if template, ok := api.Routes[route]; ok {
+		return template
+	}
+	switch route {
+	case RouteFull:
+		postcodeParam, numberParam := api.PostcodeParam, api.NumberParam
+		if postcodeParam == "" {
+			postcodeParam = defaultPostcodeParam
+		}
+		if numberParam == "" {
+			numberParam = defaultNumberParam
+		}
+		return "postcode/full?" + url.QueryEscape(postcodeParam) + "={postcode}&" + url.QueryEscape(numberParam) + "={number}"
+	}
+	return ""
+}
+
+// function to get the url of a route, filling the placeholders of its template with params
+// values are path escaped before the "?" of the template and query escaped after it
+func (api *ApiClientSettings) routeURL(route Route, params map[string]string) string {
+	path, query, hasQuery := strings.Cut(api.routeTemplate(route), "?")
+	fill := func(s string, escape func(string) string) string {
+		for name, value := range params {
+			s = strings.ReplaceAll(s, "{"+name+"}", escape(value))
+		}
+		return s
+	}
+	u := api.ApiEndpoint + fill(path, url.PathEscape)
+	if hasQuery {
+		u += "?" + fill(query, url.QueryEscape)
+	}
+	return u
+}
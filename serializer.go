@@ -0,0 +1,31 @@
+package postcodeapi
+
+import "encoding/json"
+
+// interface for encoding cache values, e.g. to use a more compact format than json for large caches
+// entries written with another serializer can't be decoded and are handled as corrupt (see StrictCache)
+type Serializer interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// struct for the default serializer, encoding cache values as json
+type JSONSerializer struct{}
+
+// function to encode v as json
+func (JSONSerializer) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// function to decode json into v
+func (JSONSerializer) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// function to get the serializer for cache values, json by default
+func (api *ApiClientSettings) serializer() Serializer {
+	if api.Serializer == nil {
+		return JSONSerializer{}
+	}
+	return api.Serializer
+}
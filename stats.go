@@ -0,0 +1,112 @@
+package postcodeapi
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// struct for lookup counters
+type Stats struct {
+	CacheHits   int64 `json:"cacheHits"`
+	CacheMisses int64 `json:"cacheMisses"`
+	ApiRequests int64 `json:"apiRequests"`
+	ApiErrors   int64 `json:"apiErrors"` // network errors, invalid responses and api errors other than 404
+	StaleHits   int64 `json:"staleHits"` // expired cache entries served because the api request failed
+
+	ShortApiRequests int64 `json:"shortApiRequests"` // full api requests made by GetPIS (included in ApiRequests)
+	RetriesDenied    int64 `json:"retriesDenied"`    // retries skipped because the RetryBudget was used up
+}
+
+// function to get the current counters
+func (api *ApiClientSettings) Stats() Stats {
+	api.statsMu.Lock()
+	defer api.statsMu.Unlock()
+	return api.stats
+}
+
+// function to get the current counters and reset them, e.g. to report a delta every interval
+func (api *ApiClientSettings) FlushStats() Stats {
+	api.statsMu.Lock()
+	defer api.statsMu.Unlock()
+	stats := api.stats
+	api.stats = Stats{}
+	return stats
+}
+
+// function to get the share of lookups served from cache (0 when no lookups have occurred)
+func (s Stats) HitRatio() float64 {
+	lookups := s.CacheHits + s.CacheMisses
+	if lookups == 0 {
+		return 0
+	}
+	return float64(s.CacheHits) / float64(lookups)
+}
+
+// function to get the cache hit ratio of the current counters, e.g. to tune CacheTtl
+func (api *ApiClientSettings) HitRatio() float64 {
+	return api.Stats().HitRatio()
+}
+
+// function to update the counters
+func (api *ApiClientSettings) countStat(update func(s *Stats)) {
+	api.statsMu.Lock()
+	update(&api.stats)
+	api.statsMu.Unlock()
+}
+
+// struct for api request latency percentiles over the last (up to 1024) requests
+type LatencyStats struct {
+	Samples int           `json:"samples"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+}
+
+// number of latency samples to keep
+const latencySamples = 1024
+
+// struct for a ring buffer of api request latencies
+type latencyRing struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	count   int // total number of recorded samples
+}
+
+// function to record the latency of an api request
+func (l *latencyRing) record(d time.Duration) {
+	l.mu.Lock()
+	l.samples[l.count%latencySamples] = d
+	l.count++
+	l.mu.Unlock()
+}
+
+// function to get the api request latency percentiles
+func (api *ApiClientSettings) LatencyStats() LatencyStats {
+	l := &api.latency
+	l.mu.Lock()
+	n := l.count
+	if n > latencySamples {
+		n = latencySamples
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, l.samples[:n])
+	l.mu.Unlock()
+
+	if n == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p int) time.Duration {
+		return sorted[(n-1)*p/100]
+	}
+	return LatencyStats{Samples: n, P50: percentile(50), P90: percentile(90), P99: percentile(99)}
+}
+
+// function to clear the recorded api request latencies
+func (api *ApiClientSettings) ResetLatencyStats() {
+	l := &api.latency
+	l.mu.Lock()
+	l.count = 0
+	l.mu.Unlock()
+}
@@ -0,0 +1,74 @@
+package postcodeapi
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// function to get a human readable summary of the effective configuration, e.g. to paste into an issue
+// the bearer token is never included, only whether it is set
+func (api *ApiClientSettings) ConfigSummary() string {
+	var b strings.Builder
+	line := func(name string, value any) {
+		fmt.Fprintf(&b, "%-22s %v\n", name+":", value)
+	}
+
+	// api
+	line("endpoint", api.redactURL(api.ApiEndpoint))
+	token := "not set"
+	if api.ApiBearerToken != "" {
+		token = "set"
+	}
+	line("token", token)
+	line("user agent", api.UserAgent)
+	line("full lookup path", api.routeTemplate(RouteFull))
+	timeout := "none"
+	if api.HttpClient != nil && api.HttpClient.Timeout > 0 {
+		timeout = api.HttpClient.Timeout.String()
+	}
+	line("timeout", timeout)
+
+	// cache
+	line("cache path", api.CachePath())
+	line("cache ttl", api.cacheTtl())
+	line("read-only cache", api.ReadOnlyCache)
+	line("postcode level cache", api.PostcodeLevelCache)
+	line("serve stale on error", api.ServeStaleOnError)
+	line("dry run", api.DryRun)
+
+	// retries
+	backoff := api.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	predicate := "default (network errors and 5xx)"
+	if api.RetryPredicate != nil {
+		predicate = "custom"
+	}
+	line("max retries", api.MaxRetries)
+	line("retry backoff", backoff)
+	line("retry predicate", predicate)
+	budget := "off"
+	if api.RetryBudget > 0 {
+		perMinute := api.RetryBudgetPerMinute
+		if perMinute <= 0 {
+			perMinute = api.RetryBudget
+		}
+		budget = fmt.Sprintf("%d retries, %d per minute", api.RetryBudget, perMinute)
+	}
+	line("retry budget", budget)
+	line("hedge delay", api.HedgeDelay)
+
+	// throttling and rate limits
+	throttle := "off"
+	if api.RequestsPerMinute > 0 {
+		throttle = fmt.Sprintf("%d requests per minute", api.RequestsPerMinute)
+	}
+	line("throttle", throttle)
+	info := api.ApiLimits()
+	line("rate limit", fmt.Sprintf("%d/%d per minute, %d/%d per day remaining",
+		info.RemainingRequests, info.MaxRequestsPerMinute, info.RemainingRequestsToday, info.MaxRequestsPerDay))
+	line("next allowed at", api.NextAllowedAt().Format(time.RFC3339))
+	return b.String()
+}
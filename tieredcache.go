@@ -0,0 +1,37 @@
+package postcodeapi
+
+// struct for a two level cache, e.g. a local buntdb in front of a shared redis
+type tieredCache struct {
+	local  Cache
+	remote Cache
+}
+
+// create new tiered cache, reads check local first and then remote, writes go to both
+// remote hits are copied to local, so the next read doesn't leave the process
+func NewTieredCache(local Cache, remote Cache) Cache {
+	return &tieredCache{local: local, remote: remote}
+}
+
+// function to get from local or remote cache
+func (t *tieredCache) Get(key string) (string, bool) {
+	if value, ok := t.local.Get(key); ok {
+		return value, true
+	}
+	value, ok := t.remote.Get(key)
+	if ok {
+		t.local.Set(key, value)
+	}
+	return value, ok
+}
+
+// function to set in both caches
+func (t *tieredCache) Set(key string, value string) {
+	t.local.Set(key, value)
+	t.remote.Set(key, value)
+}
+
+// function to delete from both caches
+func (t *tieredCache) Delete(key string) {
+	t.local.Delete(key)
+	t.remote.Delete(key)
+}
@@ -0,0 +1,24 @@
+package postcodeapi
+
+import "context"
+
+// interface for tracing lookups and api requests, e.g. with OpenTelemetry (see the otelpostcode package)
+// the core package has no tracing dependencies, a Tracer adapts any tracing library
+type Tracer interface {
+	// function to start a span, the returned function ends it with attributes and the error of the operation
+	Start(ctx context.Context, name string) (context.Context, func(attrs map[string]any, err error))
+}
+
+// span names
+const (
+	SpanLookup  = "postcodeapi.lookup"  // a lookup, from cache or api (attributes postcode, cache_hit)
+	SpanRequest = "postcodeapi.request" // a single api request (attributes status, attempt)
+)
+
+// function to start a span with the Tracer, a no-op without Tracer
+func (api *ApiClientSettings) startSpan(ctx context.Context, name string) (context.Context, func(attrs map[string]any, err error)) {
+	if api.Tracer == nil {
+		return ctx, func(map[string]any, error) {}
+	}
+	return api.Tracer.Start(ctx, name)
+}
@@ -0,0 +1,124 @@
+package postcodeapi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// default upper bound for house numbers
+const defaultMaxHouseNumber = 99999
+
+// function to validate a house number (1 up to MaxHouseNumber, default 99999)
+// returns ErrInvalidInput, so invalid numbers don't waste an api request
+func (api *ApiClientSettings) ValidateHouseNumber(number string) error {
+	maxNumber := api.MaxHouseNumber
+	if maxNumber <= 0 {
+		maxNumber = defaultMaxHouseNumber
+	}
+	if strings.TrimSpace(number) == "" {
+		return fmt.Errorf("%w: house number is empty", ErrInvalidInput)
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return fmt.Errorf("%w: house number %q is not a number", ErrInvalidInput, number)
+	}
+	if n < 1 || n > maxNumber {
+		return fmt.Errorf("%w: house number %d is not between 1 and %d", ErrInvalidInput, n, maxNumber)
+	}
+	return nil
+}
+
+// struct for the coverage of the api
+type CoverageInfo struct {
+	Country        string `json:"country"`
+	CountryCode    string `json:"countryCode"`
+	PostcodeFormat string `json:"postcodeFormat"`
+}
+
+// function to get the coverage of the api, only dutch addresses are supported
+func Coverage() CoverageInfo {
+	return CoverageInfo{
+		Country:        "Netherlands",
+		CountryCode:    "NL",
+		PostcodeFormat: "1234AB (4 digits, first digit not 0, and 2 letters, not SA, SD or SS)",
+	}
+}
+
+// regex for a dutch postcode (after removing spaces and uppercasing)
+var dutchPostcodeRe = regexp.MustCompile(`^[1-9][0-9]{3}[A-Z]{2}$`)
+
+// function to normalize a postcode for cache keys and api requests, e.g. "6931 xe" to "6931XE"
+func normalizePostcode(postcode string) string {
+	return strings.ToUpper(strings.ReplaceAll(postcode, " ", ""))
+}
+
+// function to validate a dutch postcode (e.g. 6931XE, spaces and lowercase are allowed)
+// returns ErrInvalidInput for postcodes from other countries (e.g. SW1A 1AA or 10115)
+func ValidatePostcode(postcode string) error {
+	normalized := normalizePostcode(postcode)
+	if normalized == "" {
+		return fmt.Errorf("%w: postcode is empty", ErrInvalidInput)
+	}
+	if !dutchPostcodeRe.MatchString(normalized) {
+		return fmt.Errorf("%w: %q is not a dutch postcode (%s)", ErrInvalidInput, postcode, Coverage().PostcodeFormat)
+	}
+	// letter combinations that are not used
+	switch normalized[4:] {
+	case "SA", "SD", "SS":
+		return fmt.Errorf("%w: %q is not a dutch postcode (%s is not used)", ErrInvalidInput, postcode, normalized[4:])
+	}
+	return nil
+}
+
+// struct for a range of postcode digits (inclusive), e.g. 1000 - 1009
+type PostcodeRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// digit ranges reserved for PO boxes (postbus) and reply numbers (antwoordnummer), see IsPOBoxPostcode
+// the large cities use a separate block of 10 numbers per city, these are:
+//
+//	1000 - 1009  Amsterdam
+//	2500 - 2509  Den Haag
+//	3000 - 3009  Rotterdam
+//	3500 - 3509  Utrecht
+//
+// other places mix PO box postcodes with street postcodes, so this list is not exhaustive
+// append to it (before concurrent use) when more ranges are known
+var POBoxPostcodeRanges = []PostcodeRange{
+	{From: 1000, To: 1009},
+	{From: 2500, To: 2509},
+	{From: 3000, To: 3009},
+	{From: 3500, To: 3509},
+}
+
+// function to check if a postcode is in a range reserved for PO boxes / reply numbers (see POBoxPostcodeRanges)
+// these postcodes have no street addresses, e.g. for flagging them in address forms
+// returns false for invalid postcodes
+func IsPOBoxPostcode(postcode string) bool {
+	if ValidatePostcode(postcode) != nil {
+		return false
+	}
+	digits, _ := strconv.Atoi(strings.ReplaceAll(postcode, " ", "")[:4])
+	for _, r := range POBoxPostcodeRanges {
+		if digits >= r.From && digits <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// function to reject an empty postcode or house number before an api request is built
+// the lookup methods validate the full format, this guards methods that send the input as is (e.g. FetchFromApi)
+func checkNotEmpty(postcode string, number string) error {
+	if strings.TrimSpace(postcode) == "" {
+		return fmt.Errorf("%w: postcode is empty", ErrInvalidInput)
+	}
+	if strings.TrimSpace(number) == "" {
+		return fmt.Errorf("%w: house number is empty", ErrInvalidInput)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package postcodeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestValidateHouseNumber(t *testing.T) {
+	tests := []struct {
+		number    string
+		maxNumber int
+		wantErr   bool
+	}{
+		{"1", 0, false},
+		{"130", 0, false},
+		{"99999", 0, false},
+		{"100000", 0, true},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"", 0, true},
+		{" ", 0, true},
+		{"130A", 0, true},
+		{"1.5", 0, true},
+		{"99999999999999999999", 0, true},
+		{"500", 500, false},
+		{"501", 500, true},
+	}
+	for _, tt := range tests {
+		api := &ApiClientSettings{MaxHouseNumber: tt.maxNumber}
+		err := api.ValidateHouseNumber(tt.number)
+		if tt.wantErr && !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ValidateHouseNumber(%q) with max %d error = %v, want ErrInvalidInput", tt.number, tt.maxNumber, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("ValidateHouseNumber(%q) with max %d error = %v", tt.number, tt.maxNumber, err)
+		}
+	}
+}
+
+func TestInvalidNumberSkipsApi(t *testing.T) {
+	api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAddressJson))
+	})
+	for _, number := range []string{"0", "-1", "100000"} {
+		if _, err := api.GetPostcodeInfoContext(context.Background(), "6931XE", number); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("number %q error = %v, want ErrInvalidInput", number, err)
+		}
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("%d api requests for invalid numbers, want 0", n)
+	}
+}
+
+func TestEmptyInputSkipsApi(t *testing.T) {
+	api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAddressJson))
+	})
+	ctx := context.Background()
+	methods := []struct {
+		name   string
+		lookup func(postcode, number string) error
+	}{
+		{"GetPostcodeInfoContext", func(p, n string) error { _, err := api.GetPostcodeInfoContext(ctx, p, n); return err }},
+		{"GetPostcodeInfoNoStore", func(p, n string) error { _, err := api.GetPostcodeInfoNoStore(ctx, p, n); return err }},
+		{"GetPostcodeInfoRaw", func(p, n string) error { _, err := api.GetPostcodeInfoRaw(ctx, p, n); return err }},
+		{"GetPostcodeInfoWithBudget", func(p, n string) error { _, _, err := api.GetPostcodeInfoWithBudget(ctx, p, n); return err }},
+		{"GetPostcodeInfoAll", func(p, n string) error { _, err := api.GetPostcodeInfoAll(ctx, p, n); return err }},
+		{"GetCoordinates", func(p, n string) error { _, err := api.GetCoordinates(ctx, p, n); return err }},
+		{"GetPostcodeInfoAsync", func(p, n string) error { _, err := api.GetPostcodeInfoAsync(ctx, p, n).Get(); return err }},
+		{"fetchFromApi", func(p, n string) error { _, err := api.fetchFromApi(ctx, p, n); return err }},
+		{"GetPostcodeInfoFromStringContext", func(p, n string) error {
+			_, err := api.GetPostcodeInfoFromStringContext(ctx, p+" "+n)
+			return err
+		}},
+		{"BatchGetPostcodeInfo", func(p, n string) error {
+			results, _ := api.BatchGetPostcodeInfo(ctx, []PostcodeNumber{{Postcode: p, Number: n}})
+			return results[0].Err
+		}},
+	}
+	inputs := []struct{ postcode, number string }{
+		{"", "130"},
+		{"6931XE", ""},
+		{" ", " "},
+	}
+	for _, m := range methods {
+		for _, in := range inputs {
+			if err := m.lookup(in.postcode, in.number); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("%s(%q, %q) error = %v, want ErrInvalidInput", m.name, in.postcode, in.number, err)
+			}
+		}
+	}
+	for _, in := range inputs {
+		if api.GetPIS(in.postcode, in.number) != nil || api.FetchFromApi(in.postcode, in.number) != nil {
+			t.Errorf("GetPIS / FetchFromApi(%q, %q) returned a response", in.postcode, in.number)
+		}
+		if api.GetPostcodeInfoFromString(in.postcode+" "+in.number) != nil {
+			t.Errorf("GetPostcodeInfoFromString(%q) returned a response", in.postcode+" "+in.number)
+		}
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("%d api requests for empty input, want 0", n)
+	}
+}
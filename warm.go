@@ -0,0 +1,57 @@
+package postcodeapi
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"strings"
+)
+
+// function to warm the cache from a newline-delimited file of "postcode number" entries (e.g. "6931XE 130")
+// lines are parsed with ParsePostcodeString and looked up with BatchConcurrency workers
+// duplicates are only looked up once, malformed lines are logged and skipped
+func (api *ApiClientSettings) WarmFromFile(ctx context.Context, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// read and dedup entries
+	var pairs []PostcodeNumber
+	seen := make(map[PostcodeNumber]bool)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		// skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pair, err := ParsePostcodeString(line)
+		if err != nil {
+			log.Printf("%s:%d: malformed entry: %v", path, lineNumber, err)
+			continue
+		}
+		if seen[pair] {
+			continue
+		}
+		seen[pair] = true
+		pairs = append(pairs, pair)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// look up entries, progress is reported to ProgressFunc
+	failed := 0
+	for _, result := range api.resolveAll(ctx, pairs) {
+		if result.Response == nil {
+			failed++
+		}
+	}
+	log.Printf("warming cache: %d done (%d failed)", len(pairs), failed)
+	return ctx.Err()
+}
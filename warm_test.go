@@ -0,0 +1,31 @@
+package postcodeapi
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestWarmFromFile(t *testing.T) {
+	api, hits := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAddressJson))
+	})
+	path := t.TempDir() + "/warm.txt"
+	lines := "# comment\n6931XE 130\n6931 xe 130\n6931XE, 131a\n\nnot a postcode\n6931SA 1\n6931XE 132\n"
+	if err := os.WriteFile(path, []byte(lines), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.WarmFromFile(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	// 130, 131 and 132, malformed lines and duplicates are skipped
+	if n := hits.Load(); n != 3 {
+		t.Errorf("%d api requests, want 3", n)
+	}
+	for _, number := range []string{"130", "131", "132"} {
+		if cached, _ := api.getCached("6931XE", number); !api.isFresh(cached) {
+			t.Errorf("6931XE %s not cached", number)
+		}
+	}
+}